@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+type gitea struct {
+	oauth2
+	baseURL string
+}
+
+// NewGitea returns a provider for a self-hosted Gitea or Forgejo instance
+func NewGitea(clientID, clientSecret, baseURL string) Provider {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &gitea{
+		oauth2: oauth2{
+			clientID:      clientID,
+			clientSecret:  clientSecret,
+			authEndpoint:  baseURL + "/login/oauth/authorize",
+			tokenEndpoint: baseURL + "/login/oauth/access_token",
+			scopes:        []string{"read:user"},
+		},
+		baseURL: baseURL,
+	}
+}
+
+func (g *gitea) Name() string { return "gitea" }
+
+func (g *gitea) AuthURL(_ context.Context, state, codeChallenge, redirectURI string) (string, error) {
+	return g.authURL(state, codeChallenge, redirectURI), nil
+}
+
+func (g *gitea) Exchange(ctx context.Context, code, codeVerifier, redirectURI string) (string, error) {
+	return g.exchange(ctx, code, codeVerifier, redirectURI)
+}
+
+func (g *gitea) Profile(ctx context.Context, accessToken string) (*Profile, error) {
+	var u struct {
+		ID          int64  `json:"id"`
+		Login       string `json:"login"`
+		FullName    string `json:"full_name"`
+		Email       string `json:"email"`
+		AvatarURL   string `json:"avatar_url"`
+		Description string `json:"description"`
+		HTMLURL     string `json:"html_url"`
+	}
+	if err := getJSON(ctx, g.baseURL+"/api/v1/user", accessToken, &u); err != nil {
+		return nil, err
+	}
+	if u.ID == 0 {
+		return nil, errors.New("user response has no ID")
+	}
+	profileURL := u.HTMLURL
+	if profileURL == "" {
+		// Older Gitea versions don't report it
+		profileURL = g.baseURL + "/" + u.Login
+	}
+	// Instances that skip email confirmation report unconfirmed addresses
+	// in the profile; the address list says which are verified
+	email, verified := verifiedEmail(ctx, g.baseURL+"/api/v1/user/emails", accessToken, u.Email)
+	return &Profile{
+		ID:            strconv.FormatInt(u.ID, 10),
+		Username:      u.Login,
+		Name:          u.FullName,
+		Email:         email,
+		EmailVerified: verified,
+		AvatarURL:     u.AvatarURL,
+		Bio:           u.Description,
+		ProfileURL:    profileURL,
+	}, nil
+}
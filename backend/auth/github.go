@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+type gitHub struct {
+	oauth2
+	apiURL string
+}
+
+// NewGitHub returns a provider for github.com or, with other URLs, a GitHub
+// Enterprise server
+func NewGitHub(clientID, clientSecret, baseURL, apiURL string) Provider {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &gitHub{
+		oauth2: oauth2{
+			clientID:      clientID,
+			clientSecret:  clientSecret,
+			authEndpoint:  baseURL + "/login/oauth/authorize",
+			tokenEndpoint: baseURL + "/login/oauth/access_token",
+			scopes:        []string{"user:email"},
+		},
+		apiURL: strings.TrimRight(apiURL, "/"),
+	}
+}
+
+func (g *gitHub) Name() string { return "github" }
+
+func (g *gitHub) AuthURL(_ context.Context, state, codeChallenge, redirectURI string) (string, error) {
+	return g.authURL(state, codeChallenge, redirectURI), nil
+}
+
+func (g *gitHub) Exchange(ctx context.Context, code, codeVerifier, redirectURI string) (string, error) {
+	return g.exchange(ctx, code, codeVerifier, redirectURI)
+}
+
+func (g *gitHub) Profile(ctx context.Context, accessToken string) (*Profile, error) {
+	var u struct {
+		ID        int    `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		Email     string `json:"email"`
+		AvatarURL string `json:"avatar_url"`
+		Bio       string `json:"bio"`
+		HTMLURL   string `json:"html_url"`
+	}
+	if err := getJSON(ctx, g.apiURL+"/user", accessToken, &u); err != nil {
+		return nil, err
+	}
+	if u.ID == 0 {
+		return nil, errors.New("user response has no ID")
+	}
+	email, verified := verifiedEmail(ctx, g.apiURL+"/user/emails", accessToken, u.Email)
+	return &Profile{
+		ID:            strconv.Itoa(u.ID),
+		Username:      u.Login,
+		Name:          u.Name,
+		Email:         email,
+		EmailVerified: verified,
+		AvatarURL:     u.AvatarURL,
+		Bio:           u.Bio,
+		ProfileURL:    u.HTMLURL,
+	}, nil
+}
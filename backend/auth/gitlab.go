@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+type gitLab struct {
+	oauth2
+	baseURL string
+}
+
+// NewGitLab returns a provider for gitlab.com or a self-managed GitLab
+func NewGitLab(clientID, clientSecret, baseURL string) Provider {
+	baseURL = strings.TrimRight(baseURL, "/")
+	return &gitLab{
+		oauth2: oauth2{
+			clientID:      clientID,
+			clientSecret:  clientSecret,
+			authEndpoint:  baseURL + "/oauth/authorize",
+			tokenEndpoint: baseURL + "/oauth/token",
+			scopes:        []string{"read_user"},
+		},
+		baseURL: baseURL,
+	}
+}
+
+func (g *gitLab) Name() string { return "gitlab" }
+
+func (g *gitLab) AuthURL(_ context.Context, state, codeChallenge, redirectURI string) (string, error) {
+	return g.authURL(state, codeChallenge, redirectURI), nil
+}
+
+func (g *gitLab) Exchange(ctx context.Context, code, codeVerifier, redirectURI string) (string, error) {
+	return g.exchange(ctx, code, codeVerifier, redirectURI)
+}
+
+func (g *gitLab) Profile(ctx context.Context, accessToken string) (*Profile, error) {
+	var u struct {
+		ID        int    `json:"id"`
+		Username  string `json:"username"`
+		Name      string `json:"name"`
+		Email     string `json:"email"`
+		AvatarURL string `json:"avatar_url"`
+		Bio       string `json:"bio"`
+		WebURL    string `json:"web_url"`
+	}
+	if err := getJSON(ctx, g.baseURL+"/api/v4/user", accessToken, &u); err != nil {
+		return nil, err
+	}
+	if u.ID == 0 {
+		return nil, errors.New("user response has no ID")
+	}
+	return &Profile{
+		ID:       strconv.Itoa(u.ID),
+		Username: u.Username,
+		Name:     u.Name,
+		Email:    u.Email,
+		// GitLab only lets confirmed addresses become the primary email
+		EmailVerified: u.Email != "",
+		AvatarURL:     u.AvatarURL,
+		Bio:           u.Bio,
+		ProfileURL:    u.WebURL,
+	}, nil
+}
@@ -0,0 +1,352 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"snippedia/config"
+	"snippedia/models"
+	"snippedia/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// keyPublishLead is how long a new key is published before it signs,
+	// so services that cache the JWKS know it before they see it
+	keyPublishLead = time.Hour
+
+	// keyReloadInterval limits how often an unknown kid reloads the keys
+	keyReloadInterval = time.Minute
+
+	// keyRotationCheck is how often the background job looks for due rotations
+	keyRotationCheck = 10 * time.Minute
+
+	rsaKeyBits = 2048
+)
+
+// signingKey is a decoded models.SigningKey
+type signingKey struct {
+	id          string
+	alg         string
+	generation  int
+	private     crypto.Signer
+	activatesAt time.Time
+}
+
+// keyRing holds the published signing keys, oldest first, and the cipher
+// their private keys are stored encrypted with
+type keyRing struct {
+	mu       sync.RWMutex
+	keys     []signingKey
+	loadedAt time.Time
+	aead     cipher.AEAD
+}
+
+var keys keyRing
+
+// LoadKeys loads the signing keys, creating the first one if there is none.
+// It must succeed before the server starts.
+func LoadKeys(ctx context.Context, cfg *config.Config) error {
+	return RotateKeys(ctx, cfg)
+}
+
+// StartKeyRotation rotates the signing keys in the background whenever the
+// newest key is due for replacement
+func StartKeyRotation(cfg *config.Config) {
+	go func() {
+		ticker := time.NewTicker(keyRotationCheck)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := RotateKeys(context.Background(), cfg); err != nil {
+				log.Println("Failed to rotate signing keys:", err)
+			}
+		}
+	}()
+}
+
+// RotateKeys creates the next signing key when the newest one is due for
+// replacement or uses another algorithm than configured, then reloads the
+// keys
+func RotateKeys(ctx context.Context, cfg *config.Config) error {
+	if err := keys.setSecret(cfg.SigningKeySecret); err != nil {
+		return err
+	}
+	if err := keys.load(ctx); err != nil {
+		return err
+	}
+	keys.mu.RLock()
+	var newest *signingKey
+	if n := len(keys.keys); n > 0 {
+		newest = &keys.keys[n-1]
+	}
+	keys.mu.RUnlock()
+
+	now := time.Now()
+	if newest != nil && newest.alg == cfg.JWTAlgorithm && now.Before(newest.activatesAt.Add(cfg.JWTKeyRotation-keyPublishLead)) {
+		return nil
+	}
+	next := models.SigningKey{Generation: 1, Algorithm: cfg.JWTAlgorithm, CreatedAt: now, ActivatesAt: now}
+	if newest != nil {
+		next.Generation = newest.generation + 1
+		if newest.alg == cfg.JWTAlgorithm {
+			// The current key keeps signing until the new one is known
+			next.ActivatesAt = now.Add(keyPublishLead)
+		}
+	}
+	if err := keys.generate(&next); err != nil {
+		return err
+	}
+	collection := utils.GetCollection("signing_keys")
+	_, err := collection.InsertOne(ctx, next)
+	if mongo.IsDuplicateKeyError(err) {
+		// Another instance rotated first
+		return keys.load(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	// Retire the older keys once the tokens they signed have expired
+	_, err = collection.UpdateMany(ctx,
+		bson.M{"generation": bson.M{"$lt": next.Generation}, "expires_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"expires_at": next.ActivatesAt.Add(cfg.AccessTokenTTL)}},
+	)
+	if err != nil {
+		return err
+	}
+	return keys.load(ctx)
+}
+
+// load replaces the key ring with the unexpired keys in the database
+func (r *keyRing) load(ctx context.Context) error {
+	opts := options.Find().SetSort(bson.D{{Key: "generation", Value: 1}})
+	cursor, err := utils.GetCollection("signing_keys").Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"expires_at": bson.M{"$exists": false}},
+		bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+	}}, opts)
+	if err != nil {
+		return err
+	}
+	var stored []models.SigningKey
+	if err := cursor.All(ctx, &stored); err != nil {
+		return err
+	}
+	loaded := make([]signingKey, 0, len(stored))
+	for _, s := range stored {
+		encoded, err := r.privateKey(ctx, &s)
+		if err != nil {
+			return err
+		}
+		block, _ := pem.Decode(encoded)
+		if block == nil {
+			return errors.New("signing key " + s.KeyID + " is not PEM encoded")
+		}
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return err
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return errors.New("signing key " + s.KeyID + " cannot sign")
+		}
+		loaded = append(loaded, signingKey{
+			id:          s.KeyID,
+			alg:         s.Algorithm,
+			generation:  s.Generation,
+			private:     signer,
+			activatesAt: s.ActivatesAt,
+		})
+	}
+	r.mu.Lock()
+	r.keys = loaded
+	r.loadedAt = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// setSecret derives the cipher for the stored private keys from the secret
+func (r *keyRing) setSecret(secret string) error {
+	if secret == "" {
+		return errors.New("no signing key secret")
+	}
+	sum := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.aead = aead
+	r.mu.Unlock()
+	return nil
+}
+
+// privateKey returns the PEM encoded private key of a stored key. Keys
+// stored before they were encrypted are encrypted in place.
+func (r *keyRing) privateKey(ctx context.Context, s *models.SigningKey) ([]byte, error) {
+	r.mu.RLock()
+	aead := r.aead
+	r.mu.RUnlock()
+	if aead == nil {
+		return nil, errors.New("no signing key secret")
+	}
+	if s.EncryptedKey != "" {
+		sealed, err := base64.StdEncoding.DecodeString(s.EncryptedKey)
+		if err != nil || len(sealed) < aead.NonceSize() {
+			return nil, errors.New("signing key " + s.KeyID + " is not encrypted correctly")
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		// The kid is authenticated so keys cannot be swapped between records
+		plain, err := aead.Open(nil, nonce, ciphertext, []byte(s.KeyID))
+		if err != nil {
+			return nil, errors.New("signing key " + s.KeyID + " cannot be decrypted; is SIGNING_KEY_SECRET right?")
+		}
+		return plain, nil
+	}
+	if s.PrivateKey == "" {
+		return nil, errors.New("signing key " + s.KeyID + " has no private key")
+	}
+	encrypted, err := seal(aead, s.KeyID, []byte(s.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	_, err = utils.GetCollection("signing_keys").UpdateOne(ctx,
+		bson.M{"_id": s.ID, "private_key": s.PrivateKey},
+		bson.M{"$set": bson.M{"encrypted_key": encrypted}, "$unset": bson.M{"private_key": ""}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s.PrivateKey), nil
+}
+
+// seal encrypts a private key for storage as the nonce followed by the
+// ciphertext, base64 encoded
+func seal(aead cipher.AEAD, kid string, plain []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, []byte(kid))), nil
+}
+
+// signing returns the newest key that has activated
+func (r *keyRing) signing() (signingKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := time.Now()
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		if !r.keys[i].activatesAt.After(now) {
+			return r.keys[i], nil
+		}
+	}
+	return signingKey{}, errors.New("no active signing key")
+}
+
+// lookup finds a published key by kid. Keys created by other instances are
+// picked up by reloading, at most once per keyReloadInterval.
+func (r *keyRing) lookup(kid string) (signingKey, bool) {
+	if key, ok := r.find(kid); ok {
+		return key, true
+	}
+	r.mu.RLock()
+	stale := time.Since(r.loadedAt) > keyReloadInterval
+	r.mu.RUnlock()
+	if !stale || r.load(context.Background()) != nil {
+		return signingKey{}, false
+	}
+	return r.find(kid)
+}
+
+func (r *keyRing) find(kid string) (signingKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, key := range r.keys {
+		if key.id == kid {
+			return key, true
+		}
+	}
+	return signingKey{}, false
+}
+
+// JWKS returns the public signing keys as a JSON Web Key Set
+func JWKS() []map[string]string {
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+	set := make([]map[string]string, 0, len(keys.keys))
+	for _, key := range keys.keys {
+		jwk := map[string]string{"kid": key.id, "alg": key.alg, "use": "sig"}
+		switch public := key.private.Public().(type) {
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+		set = append(set, jwk)
+	}
+	return set
+}
+
+// generate fills in a fresh key pair of the key's algorithm, encrypted for
+// storage
+func (r *keyRing) generate(key *models.SigningKey) error {
+	var private crypto.Signer
+	var err error
+	switch key.Algorithm {
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	default:
+		return errors.New("unsupported signing algorithm " + key.Algorithm)
+	}
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	kid, err := utils.RandomToken(12)
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	aead := r.aead
+	r.mu.RUnlock()
+	if aead == nil {
+		return errors.New("no signing key secret")
+	}
+	encrypted, err := seal(aead, kid, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		return err
+	}
+	key.KeyID = kid
+	key.EncryptedKey = encrypted
+	return nil
+}
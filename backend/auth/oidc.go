@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// oidc is a generic OpenID Connect provider. Its endpoints are discovered
+// from the issuer on first use and the profile is read from the userinfo
+// endpoint, so the ID token never has to be verified locally.
+type oidc struct {
+	clientID     string
+	clientSecret string
+	issuerURL    string
+}
+
+// discoveries caches discovery documents by issuer URL
+var discoveries sync.Map
+
+type oidcDiscovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// NewOIDC returns a provider for any OpenID Connect issuer
+func NewOIDC(clientID, clientSecret, issuerURL string) Provider {
+	return &oidc{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		issuerURL:    strings.TrimRight(issuerURL, "/"),
+	}
+}
+
+func (o *oidc) Name() string { return "oidc" }
+
+func (o *oidc) AuthURL(ctx context.Context, state, codeChallenge, redirectURI string) (string, error) {
+	flow, _, err := o.flow(ctx)
+	if err != nil {
+		return "", err
+	}
+	return flow.authURL(state, codeChallenge, redirectURI), nil
+}
+
+func (o *oidc) Exchange(ctx context.Context, code, codeVerifier, redirectURI string) (string, error) {
+	flow, _, err := o.flow(ctx)
+	if err != nil {
+		return "", err
+	}
+	return flow.exchange(ctx, code, codeVerifier, redirectURI)
+}
+
+func (o *oidc) Profile(ctx context.Context, accessToken string) (*Profile, error) {
+	_, userinfo, err := o.flow(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var u struct {
+		Sub               string   `json:"sub"`
+		PreferredUsername string   `json:"preferred_username"`
+		Nickname          string   `json:"nickname"`
+		Name              string   `json:"name"`
+		Email             string   `json:"email"`
+		EmailVerified     flexBool `json:"email_verified"`
+		Picture           string   `json:"picture"`
+		Profile           string   `json:"profile"`
+	}
+	if err := getJSON(ctx, userinfo, accessToken, &u); err != nil {
+		return nil, err
+	}
+	if u.Sub == "" {
+		return nil, errors.New("userinfo response has no subject")
+	}
+	username := u.PreferredUsername
+	if username == "" {
+		username = u.Nickname
+	}
+	if username == "" {
+		username, _, _ = strings.Cut(u.Email, "@")
+	}
+	return &Profile{
+		ID:            u.Sub,
+		Username:      username,
+		Name:          u.Name,
+		Email:         u.Email,
+		EmailVerified: bool(u.EmailVerified),
+		AvatarURL:     u.Picture,
+		ProfileURL:    u.Profile,
+	}, nil
+}
+
+// flexBool is a claim some issuers send as a JSON boolean and others as the
+// string "true"
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	*b = flexBool(string(data) == "true" || string(data) == `"true"`)
+	return nil
+}
+
+// flow returns the OAuth 2.0 endpoints and the userinfo endpoint of the
+// issuer, fetching the discovery document once
+func (o *oidc) flow(ctx context.Context) (*oauth2, string, error) {
+	cached, ok := discoveries.Load(o.issuerURL)
+	if !ok {
+		var d oidcDiscovery
+		if err := getJSON(ctx, o.issuerURL+"/.well-known/openid-configuration", "", &d); err != nil {
+			return nil, "", err
+		}
+		if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.UserinfoEndpoint == "" {
+			return nil, "", errors.New("incomplete OpenID Connect discovery document")
+		}
+		cached, _ = discoveries.LoadOrStore(o.issuerURL, &d)
+	}
+	d := cached.(*oidcDiscovery)
+	return &oauth2{
+		clientID:      o.clientID,
+		clientSecret:  o.clientSecret,
+		authEndpoint:  d.AuthorizationEndpoint,
+		tokenEndpoint: d.TokenEndpoint,
+		scopes:        []string{"openid", "profile", "email"},
+	}, d.UserinfoEndpoint, nil
+}
@@ -0,0 +1,179 @@
+// Package auth implements sign-in through external OAuth 2.0 and OpenID
+// Connect identity providers.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"snippedia/config"
+)
+
+// Profile is the account information an identity provider returns for the
+// signed-in user. EmailVerified reports whether the provider confirmed the
+// user owns Email; unverified addresses must never be trusted.
+type Profile struct {
+	ID            string
+	Username      string
+	Name          string
+	Email         string
+	EmailVerified bool
+	AvatarURL     string
+	Bio           string
+	ProfileURL    string
+}
+
+// Provider is an external identity provider users can sign in with
+type Provider interface {
+	// Name is the identifier used in routes, e.g. "github"
+	Name() string
+	// AuthURL is the consent screen the browser is sent to
+	AuthURL(ctx context.Context, state, codeChallenge, redirectURI string) (string, error)
+	// Exchange trades an authorization code for an access token
+	Exchange(ctx context.Context, code, codeVerifier, redirectURI string) (string, error)
+	// Profile fetches the signed-in user's profile with an access token
+	Profile(ctx context.Context, accessToken string) (*Profile, error)
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Providers returns every provider that has a client ID configured, keyed
+// by name
+func Providers(cfg *config.Config) map[string]Provider {
+	providers := make(map[string]Provider)
+	if cfg.GitHubClientID != "" {
+		providers["github"] = NewGitHub(cfg.GitHubClientID, cfg.GitHubClientSecret, cfg.GitHubURL, cfg.GitHubAPIURL)
+	}
+	if cfg.GitLabClientID != "" {
+		providers["gitlab"] = NewGitLab(cfg.GitLabClientID, cfg.GitLabClientSecret, cfg.GitLabURL)
+	}
+	if cfg.GiteaClientID != "" && cfg.GiteaURL != "" {
+		providers["gitea"] = NewGitea(cfg.GiteaClientID, cfg.GiteaClientSecret, cfg.GiteaURL)
+	}
+	if cfg.OIDCClientID != "" && cfg.OIDCIssuerURL != "" {
+		providers["oidc"] = NewOIDC(cfg.OIDCClientID, cfg.OIDCClientSecret, cfg.OIDCIssuerURL)
+	}
+	return providers
+}
+
+// oauth2 holds what every authorization-code provider shares
+type oauth2 struct {
+	clientID      string
+	clientSecret  string
+	authEndpoint  string
+	tokenEndpoint string
+	scopes        []string
+}
+
+func (o *oauth2) authURL(state, codeChallenge, redirectURI string) string {
+	params := url.Values{
+		"client_id":             {o.clientID},
+		"redirect_uri":          {redirectURI},
+		"response_type":         {"code"},
+		"scope":                 {strings.Join(o.scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	return o.authEndpoint + "?" + params.Encode()
+}
+
+func (o *oauth2) exchange(ctx context.Context, code, codeVerifier, redirectURI string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {o.clientID},
+		"client_secret": {o.clientSecret},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", o.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Errors come back as JSON too, sometimes with a 200 status
+	var tokenData struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokenData); err != nil {
+		return "", fmt.Errorf("token exchange failed: %s", resp.Status)
+	}
+	if tokenData.AccessToken == "" {
+		if tokenData.Error != "" {
+			return "", fmt.Errorf("token exchange failed: %s", tokenData.Error)
+		}
+		return "", errors.New("no access token received")
+	}
+	return tokenData.AccessToken, nil
+}
+
+// getJSON fetches url, with a bearer token if one is given, and decodes the
+// JSON response into v
+func getJSON(ctx context.Context, url, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", req.URL.Host, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// verifiedEmail picks the user's address from the list a provider serves at
+// endpoint: the profile's address if it is verified, otherwise the verified
+// primary address. If the list cannot be read, the profile's address is
+// returned unverified.
+func verifiedEmail(ctx context.Context, endpoint, accessToken, email string) (string, bool) {
+	var emails []struct {
+		Email    string `json:"email"`
+		Verified bool   `json:"verified"`
+		Primary  bool   `json:"primary"`
+	}
+	if err := getJSON(ctx, endpoint, accessToken, &emails); err != nil {
+		return email, false
+	}
+	primary := ""
+	for _, e := range emails {
+		if !e.Verified {
+			continue
+		}
+		if email != "" && strings.EqualFold(e.Email, email) {
+			return e.Email, true
+		}
+		if e.Primary {
+			primary = e.Email
+		}
+	}
+	if primary != "" {
+		return primary, true
+	}
+	return email, false
+}
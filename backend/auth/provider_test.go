@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serveJSON serves body at every path
+func serveJSON(t *testing.T, body string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		name         string
+		emails       string
+		email        string
+		want         string
+		wantVerified bool
+	}{
+		{
+			"profile address verified",
+			`[{"email":"a@example.com","verified":true,"primary":false},{"email":"b@example.com","verified":true,"primary":true}]`,
+			"A@example.com", "a@example.com", true,
+		},
+		{
+			"profile address unverified",
+			`[{"email":"a@example.com","verified":false,"primary":false},{"email":"b@example.com","verified":true,"primary":true}]`,
+			"a@example.com", "b@example.com", true,
+		},
+		{
+			"no profile address",
+			`[{"email":"b@example.com","verified":true,"primary":true}]`,
+			"", "b@example.com", true,
+		},
+		{
+			"primary unverified",
+			`[{"email":"b@example.com","verified":false,"primary":true}]`,
+			"b@example.com", "b@example.com", false,
+		},
+		{"list unreadable", `not json`, "a@example.com", "a@example.com", false},
+	}
+	for _, tt := range tests {
+		url := serveJSON(t, tt.emails)
+		got, verified := verifiedEmail(context.Background(), url, "token", tt.email)
+		if got != tt.want || verified != tt.wantVerified {
+			t.Errorf("%s: verifiedEmail = %q, %v; want %q, %v", tt.name, got, verified, tt.want, tt.wantVerified)
+		}
+	}
+}
+
+func TestFlexBool(t *testing.T) {
+	tests := map[string]bool{
+		`{"email_verified":true}`:    true,
+		`{"email_verified":"true"}`:  true,
+		`{"email_verified":false}`:   false,
+		`{"email_verified":"false"}`: false,
+		`{}`:                         false,
+	}
+	for body, want := range tests {
+		var claims struct {
+			EmailVerified flexBool `json:"email_verified"`
+		}
+		if err := json.Unmarshal([]byte(body), &claims); err != nil {
+			t.Fatalf("%s: %v", body, err)
+		}
+		if bool(claims.EmailVerified) != want {
+			t.Errorf("%s: email_verified = %v, want %v", body, claims.EmailVerified, want)
+		}
+	}
+}
+
+func TestProfileRequiresID(t *testing.T) {
+	url := serveJSON(t, `{"login":"octocat","username":"octocat"}`)
+	providers := []Provider{
+		NewGitHub("id", "secret", url, url),
+		NewGitLab("id", "secret", url),
+		NewGitea("id", "secret", url),
+	}
+	for _, p := range providers {
+		if profile, err := p.Profile(context.Background(), "token"); err == nil {
+			t.Errorf("%s: profile without an ID accepted: %+v", p.Name(), profile)
+		}
+	}
+}
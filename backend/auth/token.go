@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"snippedia/config"
+	"snippedia/utils"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AccessTokenAudience is the audience of the access tokens the API issues
+const AccessTokenAudience = "snippedia-api"
+
+// accessTokenMethods are the only signing algorithms access tokens may use;
+// tokens claiming any other, including "none" and HS256, are rejected
+var accessTokenMethods = []string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodRS256.Alg()}
+
+// AccessClaims are the claims of an access token. All registered claims the
+// API sets are required when parsing.
+type AccessClaims struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// IssueAccessToken signs a short-lived access token bound to a session with
+// the current signing key
+func IssueAccessToken(cfg *config.Config, userID, sessionID primitive.ObjectID) (string, error) {
+	key, err := keys.signing()
+	if err != nil {
+		return "", err
+	}
+	jti, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := AccessClaims{
+		UserID:    userID.Hex(),
+		SessionID: sessionID.Hex(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    cfg.PublicURL,
+			Subject:   userID.Hex(),
+			Audience:  jwt.ClaimStrings{AccessTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(cfg.AccessTokenTTL)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
+		},
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.alg), claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
+}
+
+// ParseAccessToken verifies an access token's signature and claims and
+// returns the user and session it was issued for
+func ParseAccessToken(cfg *config.Config, tokenString string) (userID, sessionID primitive.ObjectID, err error) {
+	parser := jwt.NewParser(jwt.WithValidMethods(accessTokenMethods))
+	claims := &AccessClaims{}
+	_, err = parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.lookup(kid)
+		if !ok {
+			return nil, errors.New("token is signed with an unknown key")
+		}
+		if token.Method.Alg() != key.alg {
+			return nil, errors.New("token algorithm does not match its key")
+		}
+		return key.private.Public(), nil
+	})
+	if err != nil {
+		return userID, sessionID, err
+	}
+	// The jwt package only checks exp and nbf when present
+	if claims.ExpiresAt == nil || claims.NotBefore == nil {
+		return userID, sessionID, errors.New("token must expire and have a start time")
+	}
+	if !claims.VerifyIssuer(cfg.PublicURL, true) {
+		return userID, sessionID, errors.New("token has the wrong issuer")
+	}
+	if !claims.VerifyAudience(AccessTokenAudience, true) {
+		return userID, sessionID, errors.New("token has the wrong audience")
+	}
+	if claims.ID == "" {
+		return userID, sessionID, errors.New("token has no ID")
+	}
+	if userID, err = primitive.ObjectIDFromHex(claims.UserID); err != nil {
+		return userID, sessionID, errors.New("token has an invalid user ID")
+	}
+	if sessionID, err = primitive.ObjectIDFromHex(claims.SessionID); err != nil {
+		return userID, sessionID, errors.New("token has an invalid session ID")
+	}
+	return userID, sessionID, nil
+}
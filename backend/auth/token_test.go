@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"snippedia/config"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testKeyID = "test-key"
+
+// useTestKeys replaces the key ring with a single EdDSA key for the test.
+// The ring counts as freshly loaded, so unknown kids never reach the
+// database.
+func useTestKeys(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.mu.Lock()
+	saved, savedAt := keys.keys, keys.loadedAt
+	keys.keys = []signingKey{{
+		id:          testKeyID,
+		alg:         jwt.SigningMethodEdDSA.Alg(),
+		generation:  1,
+		private:     private,
+		activatesAt: time.Now().Add(-time.Hour),
+	}}
+	keys.loadedAt = time.Now()
+	keys.mu.Unlock()
+	t.Cleanup(func() {
+		keys.mu.Lock()
+		keys.keys, keys.loadedAt = saved, savedAt
+		keys.mu.Unlock()
+	})
+	return private
+}
+
+func tokenConfig() *config.Config {
+	return &config.Config{PublicURL: "https://snippedia.test", AccessTokenTTL: 15 * time.Minute}
+}
+
+// validClaims are the claims IssueAccessToken would set
+func validClaims(cfg *config.Config) jwt.MapClaims {
+	now := time.Now()
+	userID := primitive.NewObjectID().Hex()
+	return jwt.MapClaims{
+		"user_id": userID,
+		"sid":     primitive.NewObjectID().Hex(),
+		"iss":     cfg.PublicURL,
+		"sub":     userID,
+		"aud":     []string{AccessTokenAudience},
+		"exp":     now.Add(cfg.AccessTokenTTL).Unix(),
+		"nbf":     now.Unix(),
+		"iat":     now.Unix(),
+		"jti":     "token-id",
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, claims jwt.MapClaims, key interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestIssuedAccessTokenParses(t *testing.T) {
+	useTestKeys(t)
+	cfg := tokenConfig()
+	userID, sessionID := primitive.NewObjectID(), primitive.NewObjectID()
+	token, err := IssueAccessToken(cfg, userID, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotUser, gotSession, err := ParseAccessToken(cfg, token)
+	if err != nil {
+		t.Fatalf("ParseAccessToken: %v", err)
+	}
+	if gotUser != userID || gotSession != sessionID {
+		t.Errorf("got user %s session %s, want %s %s", gotUser.Hex(), gotSession.Hex(), userID.Hex(), sessionID.Hex())
+	}
+}
+
+func TestParseAccessTokenRejectsMalicious(t *testing.T) {
+	private := useTestKeys(t)
+	cfg := tokenConfig()
+	public := private.Public().(ed25519.PublicKey)
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(change func(jwt.MapClaims)) jwt.MapClaims {
+		claims := validClaims(cfg)
+		change(claims)
+		return claims
+	}
+	valid := validClaims(cfg)
+
+	tests := []struct {
+		name  string
+		token func() string
+	}{
+		{"alg none", func() string {
+			return sign(t, jwt.SigningMethodNone, testKeyID, valid, jwt.UnsafeAllowNoneSignatureType)
+		}},
+		{"alg none without signature", func() string {
+			parts := strings.Split(sign(t, jwt.SigningMethodNone, testKeyID, valid, jwt.UnsafeAllowNoneSignatureType), ".")
+			return parts[0] + "." + parts[1]
+		}},
+		{"HS256 signed with the raw public key", func() string {
+			return sign(t, jwt.SigningMethodHS256, testKeyID, valid, []byte(public))
+		}},
+		{"HS256 signed with the DER public key", func() string {
+			return sign(t, jwt.SigningMethodHS256, testKeyID, valid, publicDER)
+		}},
+		{"RS256 under an EdDSA kid", func() string {
+			return sign(t, jwt.SigningMethodRS256, testKeyID, valid, rsaKey)
+		}},
+		{"unknown kid", func() string {
+			return sign(t, jwt.SigningMethodEdDSA, "other-key", valid, private)
+		}},
+		{"missing kid", func() string {
+			return sign(t, jwt.SigningMethodEdDSA, "", valid, private)
+		}},
+		{"signed by another key", func() string {
+			return sign(t, jwt.SigningMethodEdDSA, testKeyID, valid, otherKey)
+		}},
+		{"tampered claims", func() string {
+			parts := strings.Split(sign(t, jwt.SigningMethodEdDSA, testKeyID, valid, private), ".")
+			forged := strings.Split(sign(t, jwt.SigningMethodEdDSA, testKeyID, with(func(c jwt.MapClaims) {
+				c["user_id"] = primitive.NewObjectID().Hex()
+			}), otherKey), ".")
+			return parts[0] + "." + forged[1] + "." + parts[2]
+		}},
+		{"missing exp", func() string {
+			return sign(t, jwt.SigningMethodEdDSA, testKeyID, with(func(c jwt.MapClaims) { delete(c, "exp") }), private)
+		}},
+		{"expired", func() string {
+			return sign(t, jwt.SigningMethodEdDSA, testKeyID, with(func(c jwt.MapClaims) {
+				c["exp"] = time.Now().Add(-time.Minute).Unix()
+			}), private)
+		}},
+		{"missing nbf", func() string {
+			return sign(t, jwt.SigningMethodEdDSA, testKeyID, with(func(c jwt.MapClaims) { delete(c, "nbf") }), private)
+		}},
+		{"future nbf", func() string {
+			return sign(t, jwt.SigningMethodEdDSA, testKeyID, with(func(c jwt.MapClaims) {
+				c["nbf"] = time.Now().Add(time.Hour).Unix()
+			}), private)
+		}},
+		{"wrong iss", func() string {
+			return sign(t, jwt.SigningMethodEdDSA, testKeyID, with(func(c jwt.MapClaims) {
+				c["iss"] = "https://evil.test"
+			}), private)
+		}},
+		{"missing iss", func() string {
+			return sign(t, jwt.SigningMethodEdDSA, testKeyID, with(func(c jwt.MapClaims) { delete(c, "iss") }), private)
+		}},
+		{"wrong aud", func() string {
+			return sign(t, jwt.SigningMethodEdDSA, testKeyID, with(func(c jwt.MapClaims) {
+				c["aud"] = []string{"another-api"}
+			}), private)
+		}},
+		{"missing aud", func() string {
+			return sign(t, jwt.SigningMethodEdDSA, testKeyID, with(func(c jwt.MapClaims) { delete(c, "aud") }), private)
+		}},
+		{"missing jti", func() string {
+			return sign(t, jwt.SigningMethodEdDSA, testKeyID, with(func(c jwt.MapClaims) { delete(c, "jti") }), private)
+		}},
+		{"non-string user_id", func() string {
+			return sign(t, jwt.SigningMethodEdDSA, testKeyID, with(func(c jwt.MapClaims) { c["user_id"] = 42 }), private)
+		}},
+		{"malformed user_id", func() string {
+			return sign(t, jwt.SigningMethodEdDSA, testKeyID, with(func(c jwt.MapClaims) { c["user_id"] = "admin" }), private)
+		}},
+		{"missing sid", func() string {
+			return sign(t, jwt.SigningMethodEdDSA, testKeyID, with(func(c jwt.MapClaims) { delete(c, "sid") }), private)
+		}},
+		{"empty", func() string { return "" }},
+		{"garbage", func() string { return "not.a.token" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseAccessToken(cfg, tt.token()); err == nil {
+				t.Error("token was accepted")
+			}
+		})
+	}
+}
+
+func TestParseAccessTokenRejectsInactiveKeyAlgorithm(t *testing.T) {
+	// A kid that exists with another algorithm must not be usable
+	useTestKeys(t)
+	cfg := tokenConfig()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.mu.Lock()
+	keys.keys = append(keys.keys, signingKey{id: "rsa-key", alg: jwt.SigningMethodRS256.Alg(), generation: 2, private: rsaKey})
+	keys.mu.Unlock()
+	token := sign(t, jwt.SigningMethodPS256, "rsa-key", validClaims(cfg), rsaKey)
+	if _, _, err := ParseAccessToken(cfg, token); err == nil {
+		t.Error("PS256 token accepted for an RS256 key")
+	}
+}
@@ -0,0 +1,122 @@
+// Package badges awards users badges according to declarative rules. Rules
+// are evaluated when a relevant event happens and by a periodic backfill.
+package badges
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"snippedia/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Event is something that happened to a user that may earn them a badge
+type Event string
+
+const (
+	EventSnippetCreated   Event = "snippet_created"   // the user posted a snippet
+	EventReactionReceived Event = "reaction_received" // someone reacted to the user's snippet
+	EventBookmarkReceived Event = "bookmark_received" // someone bookmarked the user's snippet
+	EventCommented        Event = "commented"         // the user commented on a snippet
+)
+
+// backfillInterval is how often every rule is evaluated for every user
+const backfillInterval = 24 * time.Hour
+
+// Badge is a rule of the catalog: a user earns the badge once Metric
+// reaches Threshold
+type Badge struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Metric      Metric `json:"-"`
+	Threshold   int    `json:"threshold"`
+}
+
+// Catalog lists every badge that can be earned
+var Catalog = []Badge{
+	{ID: "first_snippet", Name: "First Snippet", Description: "Posted a first snippet", Metric: SnippetsPosted, Threshold: 1},
+	{ID: "useful", Name: "Useful", Description: "Received 10 useful reactions", Metric: UsefulReceived, Threshold: 10},
+	{ID: "bookmarked", Name: "Bookmarked", Description: "Had snippets bookmarked 100 times", Metric: BookmarksReceived, Threshold: 100},
+	{ID: "helpful_commenter", Name: "Helpful Commenter", Description: "Commented on 25 snippets by others", Metric: CommentsOnOthers, Threshold: 25},
+	{ID: "polyglot", Name: "Polyglot", Description: "Posted snippets in 5 languages", Metric: LanguagesUsed, Threshold: 5},
+}
+
+// Notify evaluates the rules affected by event for the user in the
+// background
+func Notify(userID primitive.ObjectID, event Event) {
+	go func() {
+		if err := Evaluate(context.Background(), userID, event); err != nil {
+			log.Println("Failed to evaluate badges:", err)
+		}
+	}()
+}
+
+// Evaluate awards the user every badge they have earned whose metric event
+// affects. An empty event evaluates every rule.
+func Evaluate(ctx context.Context, userID primitive.ObjectID, event Event) error {
+	values := map[string]int{}
+	for _, badge := range Catalog {
+		if event != "" && !badge.Metric.affectedBy(event) {
+			continue
+		}
+		value, ok := values[badge.Metric.Name]
+		if !ok {
+			var err error
+			if value, err = badge.Metric.Measure(ctx, userID); err != nil {
+				return err
+			}
+			values[badge.Metric.Name] = value
+		}
+		if value >= badge.Threshold {
+			if err := award(ctx, userID, badge.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// award gives the user the badge unless they already have it
+func award(ctx context.Context, userID primitive.ObjectID, badgeID string) error {
+	_, err := utils.GetCollection("users").UpdateOne(ctx,
+		bson.M{"_id": userID, "badges.badge": bson.M{"$ne": badgeID}},
+		bson.M{"$push": bson.M{"badges": bson.M{"badge": badgeID, "awarded_at": time.Now()}}},
+	)
+	return err
+}
+
+// StartBackfill evaluates every rule for every user now and then daily, so
+// badges earned before a rule existed or through missed events are awarded
+func StartBackfill() {
+	go func() {
+		ticker := time.NewTicker(backfillInterval)
+		defer ticker.Stop()
+		for {
+			if err := Backfill(context.Background()); err != nil {
+				log.Println("Failed to backfill badges:", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Backfill evaluates every rule for every user. A user that fails is logged
+// and skipped so one bad document cannot hold back everyone else.
+func Backfill(ctx context.Context) error {
+	values, err := utils.GetCollection("users").Distinct(ctx, "_id", bson.M{})
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			if err := Evaluate(ctx, id, ""); err != nil {
+				log.Printf("Failed to backfill badges of user %s: %v", id.Hex(), err)
+			}
+		}
+	}
+	return nil
+}
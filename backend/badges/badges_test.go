@@ -0,0 +1,135 @@
+package badges
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"snippedia/migrations"
+	"snippedia/models"
+	"snippedia/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAffectedBy(t *testing.T) {
+	tests := []struct {
+		metric Metric
+		event  Event
+		want   bool
+	}{
+		{SnippetsPosted, EventSnippetCreated, true},
+		{SnippetsPosted, EventCommented, false},
+		{UsefulReceived, EventReactionReceived, true},
+		{UsefulReceived, EventBookmarkReceived, false},
+		{BookmarksReceived, EventBookmarkReceived, true},
+		{CommentsOnOthers, EventCommented, true},
+		{LanguagesUsed, EventSnippetCreated, true},
+		{LanguagesUsed, EventReactionReceived, false},
+	}
+	for _, tt := range tests {
+		if got := tt.metric.affectedBy(tt.event); got != tt.want {
+			t.Errorf("%s affected by %s = %v, want %v", tt.metric.Name, tt.event, got, tt.want)
+		}
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	number := regexp.MustCompile(`\d+`)
+	ids := map[string]bool{}
+	for _, badge := range Catalog {
+		if ids[badge.ID] {
+			t.Errorf("badge %s listed twice", badge.ID)
+		}
+		ids[badge.ID] = true
+		if badge.Threshold < 1 {
+			t.Errorf("badge %s is awarded for nothing: threshold %d", badge.ID, badge.Threshold)
+		}
+		if badge.Metric.Measure == nil || len(badge.Metric.Events) == 0 {
+			t.Errorf("badge %s has a metric that is never measured", badge.ID)
+		}
+		// Descriptions that name a number name the threshold
+		if n := number.FindString(badge.Description); n != "" && n != strconv.Itoa(badge.Threshold) {
+			t.Errorf("badge %s: description %q disagrees with threshold %d", badge.ID, badge.Description, badge.Threshold)
+		}
+	}
+}
+
+func TestEvaluateMeasuresAffectedMetricsOnce(t *testing.T) {
+	measured := map[string]int{}
+	metric := func(name string, events ...Event) Metric {
+		return Metric{Name: name, Events: events, Measure: func(context.Context, primitive.ObjectID) (int, error) {
+			measured[name]++
+			return 0, nil
+		}}
+	}
+	posts, comments := metric("posts", EventSnippetCreated), metric("comments", EventCommented)
+	saved := Catalog
+	// Thresholds out of reach, so nothing is awarded
+	Catalog = []Badge{
+		{ID: "one", Metric: posts, Threshold: 1},
+		{ID: "two", Metric: posts, Threshold: 2},
+		{ID: "talker", Metric: comments, Threshold: 1},
+	}
+	t.Cleanup(func() { Catalog = saved })
+
+	if err := Evaluate(context.Background(), primitive.NewObjectID(), EventSnippetCreated); err != nil {
+		t.Fatal(err)
+	}
+	if measured["posts"] != 1 || measured["comments"] != 0 {
+		t.Errorf("measured %v after a new snippet, want posts once", measured)
+	}
+	if err := Evaluate(context.Background(), primitive.NewObjectID(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if measured["posts"] != 2 || measured["comments"] != 1 {
+		t.Errorf("measured %v after evaluating everything, want each metric once more", measured)
+	}
+}
+
+func TestReceivedMetricsIgnoreSelfEngagement(t *testing.T) {
+	uri := os.Getenv("SNIPPEDIA_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("SNIPPEDIA_TEST_MONGO_URI is not set")
+	}
+	ctx := context.Background()
+	if err := utils.ConnectDB(uri, "snippedia_test_"+primitive.NewObjectID().Hex()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		utils.DB.Drop(context.Background())
+		utils.DB.Client().Disconnect(context.Background())
+	})
+	if err := migrations.Run(utils.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	authorID, readerID := primitive.NewObjectID(), primitive.NewObjectID()
+	snippet := models.Snippet{
+		ID:           primitive.NewObjectID(),
+		AuthorID:     authorID,
+		Visibility:   models.VisibilityPublic,
+		CreatedAt:    time.Now(),
+		BookmarkedBy: []primitive.ObjectID{authorID, readerID},
+		Reactions: []models.Reaction{
+			{UserID: authorID, Type: models.ReactionUseful},
+			{UserID: readerID, Type: models.ReactionUseful},
+		},
+		Useful: 2,
+	}
+	if _, err := utils.GetCollection("snippets").InsertOne(ctx, snippet); err != nil {
+		t.Fatal(err)
+	}
+	for _, metric := range []Metric{UsefulReceived, BookmarksReceived} {
+		got, err := metric.Measure(ctx, authorID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != 1 {
+			t.Errorf("%s = %d, want only the reader's engagement", metric.Name, got)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package badges
+
+import (
+	"context"
+	"strings"
+
+	"snippedia/models"
+	"snippedia/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Metric is a number about a user that badges are awarded on, and the
+// events that can change it
+type Metric struct {
+	Name    string
+	Events  []Event
+	Measure func(ctx context.Context, userID primitive.ObjectID) (int, error)
+}
+
+func (m Metric) affectedBy(event Event) bool {
+	for _, e := range m.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// SnippetsPosted counts the user's snippets
+var SnippetsPosted = Metric{
+	Name:   "snippets_posted",
+	Events: []Event{EventSnippetCreated},
+	Measure: func(ctx context.Context, userID primitive.ObjectID) (int, error) {
+		count, err := utils.GetCollection("snippets").CountDocuments(ctx, bson.M{"author_id": userID})
+		return int(count), err
+	},
+}
+
+// UsefulReceived counts the useful reactions others gave the user's snippets
+var UsefulReceived = Metric{
+	Name:   "useful_received",
+	Events: []Event{EventReactionReceived},
+	Measure: func(ctx context.Context, userID primitive.ObjectID) (int, error) {
+		return sum(ctx, userID, bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$reactions", bson.A{}}},
+			"cond": bson.M{"$and": bson.A{
+				bson.M{"$eq": bson.A{"$$this.type", models.ReactionUseful}},
+				bson.M{"$ne": bson.A{"$$this.user_id", userID}},
+			}},
+		}})
+	},
+}
+
+// BookmarksReceived counts the bookmarks others put on the user's snippets
+var BookmarksReceived = Metric{
+	Name:   "bookmarks_received",
+	Events: []Event{EventBookmarkReceived},
+	Measure: func(ctx context.Context, userID primitive.ObjectID) (int, error) {
+		return sum(ctx, userID, bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$bookmarked_by", bson.A{}}},
+			"cond":  bson.M{"$ne": bson.A{"$$this", userID}},
+		}})
+	},
+}
+
+// CommentsOnOthers counts the snippets by others the user commented on
+var CommentsOnOthers = Metric{
+	Name:   "comments_on_others",
+	Events: []Event{EventCommented},
+	Measure: func(ctx context.Context, userID primitive.ObjectID) (int, error) {
+		count, err := utils.GetCollection("snippets").CountDocuments(ctx, bson.M{
+			"author_id":          bson.M{"$ne": userID},
+			"comments.author_id": userID,
+		})
+		return int(count), err
+	},
+}
+
+// LanguagesUsed counts the distinct languages of the user's snippets
+var LanguagesUsed = Metric{
+	Name:   "languages_used",
+	Events: []Event{EventSnippetCreated},
+	Measure: func(ctx context.Context, userID primitive.ObjectID) (int, error) {
+		collection := utils.GetCollection("snippets")
+		languages := map[string]bool{}
+		for _, field := range []string{"language", "files.language"} {
+			values, err := collection.Distinct(ctx, field, bson.M{"author_id": userID})
+			if err != nil {
+				return 0, err
+			}
+			for _, v := range values {
+				if language, ok := v.(string); ok && language != "" {
+					languages[strings.ToLower(language)] = true
+				}
+			}
+		}
+		return len(languages), nil
+	},
+}
+
+// sum adds up the sizes of the array expression over the user's snippets.
+// Engaging with one's own snippets never counts, so callers filter the user
+// out of the array.
+func sum(ctx context.Context, userID primitive.ObjectID, array bson.M) (int, error) {
+	cursor, err := utils.GetCollection("snippets").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"author_id": userID}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": bson.M{"$size": array}}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var result []struct {
+		Total int `bson:"total"`
+	}
+	if err := cursor.All(ctx, &result); err != nil || len(result) == 0 {
+		return 0, err
+	}
+	return result[0].Total, nil
+}
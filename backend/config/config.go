@@ -1,7 +1,10 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -9,22 +12,136 @@ type Config struct {
 	MongoURI           string
 	DatabaseName       string
 	Port               string
+	PublicURL          string
+	FrontendURL        string
 	GitHubClientID     string
 	GitHubClientSecret string
-	JWTSecret          string
-	JWTExpiration      time.Duration
+	GitHubURL          string
+	GitHubAPIURL       string
+	GitLabClientID     string
+	GitLabClientSecret string
+	GitLabURL          string
+	GiteaClientID      string
+	GiteaClientSecret  string
+	GiteaURL           string
+	OIDCClientID       string
+	OIDCClientSecret   string
+	OIDCIssuerURL      string
+	StateSecret        string
+	SigningKeySecret   string
+	JWTAlgorithm       string
+	JWTKeyRotation     time.Duration
+	AccessTokenTTL     time.Duration
+	RefreshTokenTTL    time.Duration
+	SessionMode        string
+	ProxyHeader        string
+	TrustedProxies     []string
+	Ranking            RankingConfig
 }
 
+// RankingConfig tunes the hot and trending feeds. Weights say how much each
+// kind of engagement counts towards a snippet's score.
+type RankingConfig struct {
+	ReactionWeight   float64
+	BookmarkWeight   float64
+	CommentWeight    float64
+	ViewWeight       float64
+	TrendingHalfLife time.Duration // how fast engagement stops counting for trending
+	HotGravity       float64       // how fast snippets sink in hot as they age
+	HotWindow        time.Duration // only snippets this young can be hot
+	Interval         time.Duration // how often rankings and leaderboards are recomputed
+	Size             int           // how many snippets a ranking holds
+}
+
+// Ways of handing the session token to the frontend after login
+const (
+	// SessionModeCode redirects with a short-lived one-time code that the
+	// frontend exchanges for the token via POST /auth/token
+	SessionModeCode = "code"
+	// SessionModeCookie keeps the token in an HttpOnly cookie
+	SessionModeCookie = "cookie"
+
+	// SessionCookie and RefreshCookie are the cookies used in cookie mode
+	SessionCookie = "session"
+	RefreshCookie = "refresh_token"
+)
+
 func LoadConfig() *Config {
 	return &Config{
 		MongoURI:           getEnv("MONGO_URI", "mongodb://localhost:27017"),
 		DatabaseName:       getEnv("DB_NAME", "Snippedia"),
 		Port:               getEnv("PORT", "8080"),
+		PublicURL:          getEnv("PUBLIC_URL", "http://localhost:8080"), // externally visible URL of this server
+		FrontendURL:        getEnv("FRONTEND_URL", ""),
 		GitHubClientID:     getEnv("GITHUB_CLIENT_ID", ""),
 		GitHubClientSecret: getEnv("GITHUB_CLIENT_SECRET", ""),
-		JWTSecret:          getEnv("JWT_SECRET", "your-secret-key"),
-		JWTExpiration:      time.Hour * 24 * 7, // 7 days
+		GitHubURL:          getEnv("GITHUB_URL", "https://github.com"),
+		GitHubAPIURL:       getEnv("GITHUB_API_URL", "https://api.github.com"),
+		GitLabClientID:     getEnv("GITLAB_CLIENT_ID", ""),
+		GitLabClientSecret: getEnv("GITLAB_CLIENT_SECRET", ""),
+		GitLabURL:          getEnv("GITLAB_URL", "https://gitlab.com"),
+		GiteaClientID:      getEnv("GITEA_CLIENT_ID", ""),
+		GiteaClientSecret:  getEnv("GITEA_CLIENT_SECRET", ""),
+		GiteaURL:           getEnv("GITEA_URL", ""), // Gitea and Forgejo are always self-hosted
+		OIDCClientID:       getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:   getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCIssuerURL:      getEnv("OIDC_ISSUER_URL", ""),
+		StateSecret:        getEnv("STATE_SECRET", ""),       // signs the OAuth login state
+		SigningKeySecret:   getEnv("SIGNING_KEY_SECRET", ""), // encrypts the signing keys stored in the database
+		JWTAlgorithm:       getEnv("JWT_ALGORITHM", "EdDSA"),
+		JWTKeyRotation:     time.Hour * 24 * 30, // 30 days
+		AccessTokenTTL:     time.Minute * 15,
+		RefreshTokenTTL:    time.Hour * 24 * 30, // 30 days
+		SessionMode:        getEnv("SESSION_MODE", SessionModeCode),
+		ProxyHeader:        getEnv("PROXY_HEADER", ""), // e.g. X-Forwarded-For behind a reverse proxy
+		TrustedProxies:     getEnvList("TRUSTED_PROXIES"),
+		Ranking: RankingConfig{
+			ReactionWeight:   getEnvFloat("RANK_REACTION_WEIGHT", 3),
+			BookmarkWeight:   getEnvFloat("RANK_BOOKMARK_WEIGHT", 4),
+			CommentWeight:    getEnvFloat("RANK_COMMENT_WEIGHT", 2),
+			ViewWeight:       getEnvFloat("RANK_VIEW_WEIGHT", 0.1),
+			TrendingHalfLife: time.Hour * 24,
+			HotGravity:       getEnvFloat("RANK_HOT_GRAVITY", 1.8),
+			HotWindow:        time.Hour * 24 * 7, // 7 days
+			Interval:         time.Minute * 5,
+			Size:             500,
+		},
+	}
+}
+
+// insecureSecrets are placeholder secrets from old examples and defaults
+var insecureSecrets = map[string]bool{
+	"your-secret-key": true,
+	"your_jwt_secret": true,
+}
+
+// Validate refuses configurations that are unsafe to run with
+func (c *Config) Validate() error {
+	if insecureSecrets[c.StateSecret] {
+		return errors.New("STATE_SECRET is set to a well-known placeholder")
+	}
+	if len(c.StateSecret) < 32 {
+		// It no longer falls back to JWT_SECRET, which was often short
+		return errors.New("STATE_SECRET must be set to at least 32 characters")
+	}
+	if len(c.SigningKeySecret) < 32 {
+		return errors.New("SIGNING_KEY_SECRET must be set to at least 32 characters")
 	}
+	if c.SigningKeySecret == c.StateSecret {
+		return errors.New("SIGNING_KEY_SECRET must differ from STATE_SECRET")
+	}
+	if c.ProxyHeader != "" && len(c.TrustedProxies) == 0 {
+		// Anyone could claim any address otherwise
+		return errors.New("TRUSTED_PROXIES must be set when PROXY_HEADER is")
+	}
+	if c.JWTAlgorithm != "EdDSA" && c.JWTAlgorithm != "RS256" {
+		return errors.New("JWT_ALGORITHM must be EdDSA or RS256")
+	}
+	r := c.Ranking
+	if r.ReactionWeight < 0 || r.BookmarkWeight < 0 || r.CommentWeight < 0 || r.ViewWeight < 0 || r.HotGravity <= 0 {
+		return errors.New("ranking weights cannot be negative and RANK_HOT_GRAVITY must be positive")
+	}
+	return nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -34,3 +151,22 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvList splits a comma-separated variable, skipping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateSecrets(t *testing.T) {
+	long := strings.Repeat("s", 32)
+	tests := []struct {
+		name       string
+		state      string
+		jwt        string
+		signingKey string
+		wantErr    string
+	}{
+		{"valid", long, "", strings.Repeat("k", 32), ""},
+		{"state secret missing", "", "", strings.Repeat("k", 32), "STATE_SECRET"},
+		{"only the old JWT secret", "", long, strings.Repeat("k", 32), "STATE_SECRET"},
+		{"state secret too short", strings.Repeat("s", 31), "", strings.Repeat("k", 32), "STATE_SECRET"},
+		{"state secret a placeholder", "your-secret-key", "", strings.Repeat("k", 32), "placeholder"},
+		{"signing key too short", long, "", strings.Repeat("k", 31), "SIGNING_KEY_SECRET"},
+		{"secrets shared", long, "", long, "differ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STATE_SECRET", tt.state)
+			t.Setenv("JWT_SECRET", tt.jwt)
+			t.Setenv("SIGNING_KEY_SECRET", tt.signingKey)
+			err := LoadConfig().Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want an error about %s", err, tt.wantErr)
+			}
+		})
+	}
+}
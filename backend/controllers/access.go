@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"context"
+
+	"snippedia/models"
+	"snippedia/policy"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// currentSubject returns the policy subject of the request. The caller's
+// organization roles are loaded once and cached in the "subject" local.
+func currentSubject(c *fiber.Ctx) (policy.Subject, error) {
+	if subject, ok := c.Locals("subject").(policy.Subject); ok {
+		return subject, nil
+	}
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return policy.Anonymous, nil
+	}
+	roles, err := userOrgRoles(user.ID)
+	if err != nil {
+		return policy.Anonymous, err
+	}
+	subject := policy.Subject{User: &user, OrgRoles: roles}
+	c.Locals("subject", subject)
+	return subject, nil
+}
+
+// listedSnippetsFilter matches the snippets that may appear in shared
+// listings such as the main feed and search results
+func listedSnippetsFilter() bson.M {
+	return bson.M{"visibility": models.VisibilityPublic}
+}
+
+// readableSnippetsFilter matches every snippet the subject may read,
+// including unlisted snippets, the subject's own private snippets and team
+// snippets of the subject's organizations. Use it for per-user listings like
+// bookmarks, never for shared feeds. It matches what policy.ReadSnippet
+// allows ordinary users; moderators may open others' private and team
+// snippets one at a time, but those never show up in their listings.
+func readableSnippetsFilter(subject policy.Subject) bson.M {
+	if subject.User == nil {
+		return bson.M{"visibility": bson.M{"$in": bson.A{models.VisibilityPublic, models.VisibilityUnlisted}}}
+	}
+	orgIDs := make([]primitive.ObjectID, 0, len(subject.OrgRoles))
+	for id := range subject.OrgRoles {
+		orgIDs = append(orgIDs, id)
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{"visibility": bson.M{"$in": bson.A{models.VisibilityPublic, models.VisibilityUnlisted}}},
+		bson.M{"author_id": subject.User.ID},
+		bson.M{"visibility": models.VisibilityTeam, "org_id": bson.M{"$in": orgIDs}},
+	}}
+}
+
+// userOrgRoles maps every organization the user belongs to to the user's role
+func userOrgRoles(userID primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	opts := options.Find().SetProjection(bson.M{"members": bson.M{"$elemMatch": bson.M{"user_id": userID}}})
+	cursor, err := utils.GetCollection("organizations").Find(context.Background(), bson.M{"members.user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var orgs []models.Organization
+	if err := cursor.All(context.Background(), &orgs); err != nil {
+		return nil, err
+	}
+	roles := make(map[primitive.ObjectID]string, len(orgs))
+	for _, org := range orgs {
+		roles[org.ID] = org.RoleOf(userID)
+	}
+	return roles, nil
+}
+
+// authorizeSnippet loads a snippet and checks that the caller may perform
+// action on it. Snippets the caller cannot read are reported as not found so
+// that their existence does not leak.
+func authorizeSnippet(c *fiber.Ctx, id primitive.ObjectID, action policy.Action) (*models.Snippet, error) {
+	var snippet models.Snippet
+	err := utils.GetCollection("snippets").FindOne(context.Background(), bson.M{"_id": id}).Decode(&snippet)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Snippet not found")
+	}
+	subject, err := currentSubject(c)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to check permissions")
+	}
+	if !policy.Can(subject, action, &snippet) {
+		if !policy.Can(subject, policy.ReadSnippet, &snippet) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "Snippet not found")
+		}
+		return nil, fiber.NewError(fiber.StatusForbidden, "You are not allowed to do this")
+	}
+	return &snippet, nil
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"snippedia/models"
+	"snippedia/policy"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// matches evaluates the subset of MongoDB queries the snippet filters use:
+// equality, $in and $or
+func matches(t *testing.T, filter bson.M, doc bson.M) bool {
+	t.Helper()
+	for field, cond := range filter {
+		if field == "$or" {
+			matched := false
+			for _, clause := range cond.(bson.A) {
+				if matches(t, clause.(bson.M), doc) {
+					matched = true
+				}
+			}
+			if !matched {
+				return false
+			}
+			continue
+		}
+		op, ok := cond.(bson.M)
+		if !ok {
+			if doc[field] != cond {
+				return false
+			}
+			continue
+		}
+		for name, arg := range op {
+			if name != "$in" {
+				t.Fatalf("unsupported operator %s", name)
+			}
+			in := false
+			list := reflect.ValueOf(arg)
+			for i := 0; i < list.Len(); i++ {
+				if list.Index(i).Interface() == doc[field] {
+					in = true
+				}
+			}
+			if !in {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func snippetDoc(s *models.Snippet) bson.M {
+	return bson.M{"visibility": s.Visibility, "author_id": s.AuthorID, "org_id": s.OrgID}
+}
+
+func TestSnippetFilters(t *testing.T) {
+	author := &models.User{ID: primitive.NewObjectID(), Role: models.RoleUser}
+	member := &models.User{ID: primitive.NewObjectID(), Role: models.RoleUser}
+	stranger := &models.User{ID: primitive.NewObjectID(), Role: models.RoleUser}
+	orgID, otherOrgID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	var snippets []*models.Snippet
+	for _, visibility := range []string{models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate, models.VisibilityTeam} {
+		for _, org := range []primitive.ObjectID{primitive.NilObjectID, orgID, otherOrgID} {
+			snippets = append(snippets, &models.Snippet{Visibility: visibility, AuthorID: author.ID, OrgID: org})
+		}
+	}
+	subjects := map[string]policy.Subject{
+		"anonymous": policy.Anonymous,
+		"author":    {User: author},
+		"member":    {User: member, OrgRoles: map[primitive.ObjectID]string{orgID: models.OrgRoleMember}},
+		"stranger":  {User: stranger},
+	}
+
+	for name, subject := range subjects {
+		filter := readableSnippetsFilter(subject)
+		for _, s := range snippets {
+			want := policy.Can(subject, policy.ReadSnippet, s)
+			if got := matches(t, filter, snippetDoc(s)); got != want {
+				t.Errorf("%s: readable filter matches %s snippet of org %v: %v, policy says %v", name, s.Visibility, s.OrgID, got, want)
+			}
+		}
+	}
+
+	for _, s := range snippets {
+		want := s.Visibility == models.VisibilityPublic
+		if got := matches(t, listedSnippetsFilter(), snippetDoc(s)); got != want {
+			t.Errorf("listed filter matches %s snippet: %v, want %v", s.Visibility, got, want)
+		}
+	}
+}
+
+func TestReadableFilterLeavesModeratorsOut(t *testing.T) {
+	moderator := &models.User{ID: primitive.NewObjectID(), Role: models.RoleModerator}
+	private := &models.Snippet{Visibility: models.VisibilityPrivate, AuthorID: primitive.NewObjectID()}
+	subject := policy.Subject{User: moderator}
+	if !policy.Can(subject, policy.ReadSnippet, private) {
+		t.Fatal("moderators may read private snippets")
+	}
+	if matches(t, readableSnippetsFilter(subject), snippetDoc(private)) {
+		t.Error("others' private snippets listed for a moderator")
+	}
+}
+
+func TestReadableFilterDocuments(t *testing.T) {
+	user := &models.User{ID: primitive.NewObjectID()}
+	orgID := primitive.NewObjectID()
+	readable := bson.M{"visibility": bson.M{"$in": bson.A{models.VisibilityPublic, models.VisibilityUnlisted}}}
+	tests := []struct {
+		subject policy.Subject
+		want    bson.M
+	}{
+		{policy.Anonymous, readable},
+		{
+			policy.Subject{User: user, OrgRoles: map[primitive.ObjectID]string{orgID: models.OrgRoleMember}},
+			bson.M{"$or": bson.A{
+				readable,
+				bson.M{"author_id": user.ID},
+				bson.M{"visibility": models.VisibilityTeam, "org_id": bson.M{"$in": []primitive.ObjectID{orgID}}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		if got := readableSnippetsFilter(tt.subject); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("readableSnippetsFilter = %v, want %v", got, tt.want)
+		}
+	}
+	if got, want := listedSnippetsFilter(), (bson.M{"visibility": models.VisibilityPublic}); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("listedSnippetsFilter = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"snippedia/models"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxAccessTokenNameLength = 100
+	defaultAccessTokenDays   = 30
+	maxAccessTokenDays       = 365
+)
+
+// Create a personal access token for the caller. Only a signed-in session
+// may do this; a token that could mint tokens would never really expire.
+func CreateAccessToken(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	if _, ok := c.Locals("session_id").(primitive.ObjectID); !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access tokens can only be created from a signed-in session"})
+	}
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxAccessTokenNameLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Name is required and must be at most 100 characters"})
+	}
+	if len(req.Scopes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "At least one scope is required"})
+	}
+	for _, scope := range req.Scopes {
+		if !models.ValidScope(scope) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scope: " + scope})
+		}
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultAccessTokenDays
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAccessTokenDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Tokens must expire within 365 days"})
+	}
+
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	}
+	token := models.AccessTokenPrefix + secret
+	now := time.Now()
+	pat := models.PersonalAccessToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Name:      req.Name,
+		TokenHash: utils.HashToken(token),
+		Scopes:    req.Scopes,
+		ExpiresAt: now.AddDate(0, 0, req.ExpiresInDays),
+		CreatedAt: now,
+	}
+	if _, err := utils.GetCollection("access_tokens").InsertOne(context.Background(), pat); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create token"})
+	}
+	// The token is only ever returned here; we keep just its hash
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"access_token": pat,
+		"token":        token,
+	})
+}
+
+// List the caller's personal access tokens
+func GetAccessTokens(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := utils.GetCollection("access_tokens").Find(context.Background(), bson.M{"user_id": user.ID}, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch tokens"})
+	}
+	tokens := []models.PersonalAccessToken{}
+	if err := cursor.All(context.Background(), &tokens); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode tokens"})
+	}
+	return c.JSON(tokens)
+}
+
+// Revoke one of the caller's personal access tokens
+func RevokeAccessToken(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	tokenID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid token ID"})
+	}
+	result, err := utils.GetCollection("access_tokens").UpdateOne(context.Background(),
+		bson.M{"_id": tokenID, "user_id": user.ID},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke token"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Token not found"})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
@@ -2,212 +2,291 @@ package controllers
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"os"
+	"log"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"snippedia/auth"
+	"snippedia/badges"
 	"snippedia/config"
+	"snippedia/feeds"
 	"snippedia/models"
+	"snippedia/policy"
+	"snippedia/reputation"
 	"snippedia/utils"
+	"snippedia/views"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v4"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-type GitHubUser struct {
-	ID        int    `json:"id"`
-	Login     string `json:"login"`
-	Email     string `json:"email"`
-	AvatarURL string `json:"avatar_url"`
-	Bio       string `json:"bio"`
-	HTMLURL   string `json:"html_url"`
-}
-
-func GitHubCallback(c *fiber.Ctx) error {
-	code := c.Query("code")
-	if code == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Code is required",
-		})
-	}
-
-	// Exchange code for access token
-	tokenReqBody := fmt.Sprintf(
-		"client_id=%s&client_secret=%s&code=%s",
-		config.LoadConfig().GitHubClientID,
-		config.LoadConfig().GitHubClientSecret,
-		code,
-	)
-	tokenReq, err := http.NewRequest("POST", "https://github.com/login/oauth/access_token", strings.NewReader(tokenReqBody))
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create token request",
-		})
-	}
-	tokenReq.Header.Set("Accept", "application/json")
-	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	client := &http.Client{}
-	tokenResp, err := client.Do(tokenReq)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get access token",
-		})
-	}
-	defer tokenResp.Body.Close()
-
-	var tokenData struct {
-		AccessToken string `json:"access_token"`
-		Scope       string `json:"scope"`
-		TokenType   string `json:"token_type"`
-	}
-	if err := json.NewDecoder(tokenResp.Body).Decode(&tokenData); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to parse access token",
-		})
-	}
-	if tokenData.AccessToken == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "No access token received from GitHub",
-		})
-	}
-
-	// Get user info from GitHub
-	userReq, err := http.NewRequest("GET", "https://api.github.com/user", nil)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create user info request",
-		})
-	}
-	userReq.Header.Set("Authorization", "Bearer "+tokenData.AccessToken)
-	userReq.Header.Set("Accept", "application/json")
-
-	userResp, err := client.Do(userReq)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get user info",
-		})
-	}
-	defer userResp.Body.Close()
-
-	body, err := io.ReadAll(userResp.Body)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to read user info response",
-		})
-	}
+// Finish an OAuth login: verify the state, exchange the code, then create or
+// update the user and hand a session to the frontend. Flows started from the
+// profile page link the identity to the signed-in account instead.
+func OAuthCallback(cfg *config.Config) fiber.Handler {
+	providers := auth.Providers(cfg)
+	return func(c *fiber.Ctx) error {
+		provider, ok := providers[c.Params("provider")]
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Unknown login provider",
+			})
+		}
+		code := c.Query("code")
+		if code == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Code is required",
+			})
+		}
 
-	var githubUser GitHubUser
-	if err := json.Unmarshal(body, &githubUser); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to parse user info",
-		})
-	}
+		// Only finish logins this browser started
+		state, err := consumeOAuthState(c, cfg.StateSecret, provider.Name())
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid login state, please try logging in again",
+			})
+		}
 
-	// Create or update user in database
-	user := models.User{
-		GitHubID:  githubUser.ID,
-		Username:  githubUser.Login,
-		Email:     githubUser.Email,
-		AvatarURL: githubUser.AvatarURL,
-		Bio:       githubUser.Bio,
-		GitHubURL: githubUser.HTMLURL,
-		UpdatedAt: time.Now(),
-	}
+		// Exchange code for access token
+		ctx := context.Background()
+		accessToken, err := provider.Exchange(ctx, code, state.Verifier, oauthRedirectURI(cfg, provider))
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Failed to get access token",
+			})
+		}
 
-	collection := utils.GetCollection("users")
-	var existingUser models.User
-	err = collection.FindOne(context.Background(), bson.M{"github_id": githubUser.ID}).Decode(&existingUser)
-	if err != nil {
-		// Create new user
-		user.CreatedAt = time.Now()
-		result, err := collection.InsertOne(context.Background(), user)
+		// Get user info from the provider
+		profile, err := provider.Profile(ctx, accessToken)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to create user",
+				"error": "Failed to get user info",
 			})
 		}
-		user.ID = result.InsertedID.(primitive.ObjectID)
-	} else {
-		// Update existing user with latest GitHub info
-		user.ID = existingUser.ID
-		user.CreatedAt = existingUser.CreatedAt
-		_, err = collection.UpdateOne(
-			context.Background(),
-			bson.M{"_id": existingUser.ID},
-			bson.M{"$set": user},
-		)
+		if !profile.EmailVerified {
+			// Anyone can claim an address the provider has not verified, so it
+			// is neither stored nor matched against existing accounts
+			profile.Email = ""
+		}
+
+		identity, err := findIdentity(provider.Name(), profile.ID)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to update user",
+				"error": "Failed to look up identity",
 			})
 		}
-	}
+		if state.LinkUserID != "" {
+			return finishIdentityLink(c, cfg, state.LinkUserID, provider.Name(), profile, identity)
+		}
 
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID.Hex(),
-		"exp":     time.Now().Add(config.LoadConfig().JWTExpiration).Unix(),
-	})
+		collection := utils.GetCollection("users")
+		var userID primitive.ObjectID
+		if identity == nil {
+			// Never merge into an existing account just because the email
+			// matches. The owner can sign in the usual way and link this
+			// identity from their profile.
+			if profile.Email != "" {
+				count, err := collection.CountDocuments(ctx, bson.M{"email": profile.Email})
+				if err != nil {
+					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+						"error": "Failed to look up user",
+					})
+				}
+				if count > 0 {
+					return c.Redirect(cfg.FrontendURL + "/login?error=account_exists")
+				}
+			}
+
+			// Create new user
+			now := time.Now()
+			user := models.User{
+				Email:       profile.Email,
+				AvatarURL:   profile.AvatarURL,
+				Bio:         profile.Bio,
+				Badges:      []models.AwardedBadge{},
+				CreatedAt:   now,
+				UpdatedAt:   now,
+				LastLoginAt: &now,
+			}
+			if provider.Name() == "github" {
+				user.GitHubID, err = strconv.Atoi(profile.ID)
+				if err != nil {
+					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+						"error": "Failed to parse user info",
+					})
+				}
+				user.GitHubURL = profile.ProfileURL
+			}
+			userID, err = insertUser(ctx, &user, profile.Username)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to create user",
+				})
+			}
+			if _, err := createIdentity(userID, provider.Name(), profile); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to create identity",
+				})
+			}
+		} else {
+			var existingUser models.User
+			if err := collection.FindOne(ctx, bson.M{"_id": identity.UserID}).Decode(&existingUser); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to load user",
+				})
+			}
+			if err := syncProfile(ctx, &existingUser, identity, profile); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to update user",
+				})
+			}
+			touchIdentity(identity.ID, profile)
+			userID = existingUser.ID
+		}
 
-	tokenString, err := token.SignedString([]byte(config.LoadConfig().JWTSecret))
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to generate token",
-		})
+		return completeLogin(c, cfg, userID)
 	}
-
-	return c.Redirect(os.Getenv("FRONTEND_URL") + "/?token=" + tokenString)
 }
 
-// User profile stubs
+// Return the caller's own profile
 func GetUserProfile(c *fiber.Ctx) error {
 	user, ok := c.Locals("user").(models.User)
 	if !ok {
 		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
 	}
-	return c.JSON(fiber.Map{
+	return c.JSON(ownProfile(user))
+}
+
+// Edit the caller's profile. Only the fields present in the body change.
+// Editing the bio stops it from being synced from the sign-in provider.
+func UpdateUserProfile(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	var req struct {
+		Bio                *string                 `json:"bio"`
+		DisplayName        *string                 `json:"display_name"`
+		Location           *string                 `json:"location"`
+		Website            *string                 `json:"website"`
+		Pronouns           *string                 `json:"pronouns"`
+		PreferredLanguages *[]string               `json:"preferred_languages"`
+		Preferences        *models.UserPreferences `json:"preferences"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	profile := user.Profile
+	if req.DisplayName != nil {
+		profile.DisplayName = strings.TrimSpace(*req.DisplayName)
+	}
+	if req.Location != nil {
+		profile.Location = strings.TrimSpace(*req.Location)
+	}
+	if req.Website != nil {
+		profile.Website = strings.TrimSpace(*req.Website)
+	}
+	if req.Pronouns != nil {
+		profile.Pronouns = strings.TrimSpace(*req.Pronouns)
+	}
+	if req.PreferredLanguages != nil {
+		profile.PreferredLanguages = []string{}
+		for _, lang := range *req.PreferredLanguages {
+			profile.PreferredLanguages = append(profile.PreferredLanguages, strings.TrimSpace(lang))
+		}
+	}
+	if req.Preferences != nil {
+		profile.Preferences = *req.Preferences
+	}
+	if err := profile.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	update := bson.M{"$set": bson.M{"profile": profile, "updated_at": time.Now()}}
+	user.Profile = profile
+	if req.Bio != nil {
+		bio := strings.TrimSpace(*req.Bio)
+		if utf8.RuneCountInString(bio) > models.MaxBioLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Bio is too long"})
+		}
+		update["$set"].(bson.M)["bio"] = bio
+		update["$addToSet"] = bson.M{"edited_fields": models.FieldBio}
+		user.Bio = bio
+	}
+	if _, err := utils.GetCollection("users").UpdateByID(context.Background(), user.ID, update); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update profile"})
+	}
+	return c.JSON(ownProfile(user))
+}
+
+// ownProfile is the profile as its owner sees it
+func ownProfile(user models.User) fiber.Map {
+	return fiber.Map{
 		"id":             user.ID.Hex(),
 		"username":       user.Username,
 		"avatar_url":     user.AvatarURL,
 		"bio":            user.Bio,
 		"github_url":     user.GitHubURL,
 		"email":          user.Email,
+		"profile":        user.Profile,
 		"badges":         user.Badges,
+		"reputation":     user.Reputation,
 		"bookmarked_ids": user.BookmarkedIDs,
-	})
-}
-
-func UpdateUserProfile(c *fiber.Ctx) error {
-	return c.SendStatus(fiber.StatusNotImplemented)
+	}
 }
 
 // Snippet CRUD stubs
 func CreateSnippet(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
 	var snippet models.Snippet
 	if err := c.BodyParser(&snippet); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
 	}
+	snippet.Normalize()
+	if err := snippet.ValidateFiles(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	tags, err := models.NormalizeTags(snippet.Tags)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	snippet.Tags = tags
+	if !models.ValidVisibility(snippet.Visibility) {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid visibility"})
+	}
+	if snippet.Visibility == models.VisibilityTeam && snippet.OrgID.IsZero() {
+		return c.Status(400).JSON(fiber.Map{"error": "Team snippets must belong to an organization"})
+	}
+	if !snippet.OrgID.IsZero() {
+		var org models.Organization
+		err := utils.GetCollection("organizations").FindOne(context.Background(), bson.M{"_id": snippet.OrgID}).Decode(&org)
+		if err != nil || !policy.Can(policy.Subject{User: &user}, policy.CreateOrgSnippet, &org) {
+			return c.Status(403).JSON(fiber.Map{"error": "You are not a member of this organization"})
+		}
+	}
 	snippet.ID = primitive.NewObjectID()
+	snippet.AuthorID = user.ID
 	snippet.CreatedAt = time.Now()
 	snippet.UpdatedAt = time.Now()
 	collection := utils.GetCollection("snippets")
-	_, err := collection.InsertOne(context.Background(), snippet)
+	_, err = collection.InsertOne(context.Background(), snippet)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to create snippet"})
 	}
+	badges.Notify(user.ID, badges.EventSnippetCreated)
 	return c.Status(201).JSON(snippet)
 }
 
 func GetSnippets(c *fiber.Ctx) error {
 	collection := utils.GetCollection("snippets")
-	cursor, err := collection.Find(context.Background(), bson.M{})
+	cursor, err := collection.Find(context.Background(), listedSnippetsFilter())
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch snippets"})
 	}
@@ -216,79 +295,107 @@ func GetSnippets(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to decode snippets"})
 	}
 
-	// Populate author info for each snippet
-	userCollection := utils.GetCollection("users")
-	var result []map[string]interface{}
-	for _, snip := range snippets {
-		snippetMap := make(map[string]interface{})
-		data, _ := bson.Marshal(snip)
-		_ = bson.Unmarshal(data, &snippetMap)
-		var author models.User
-		if err := userCollection.FindOne(context.Background(), bson.M{"_id": snip.AuthorID}).Decode(&author); err == nil {
-			snippetMap["author_username"] = author.Username
-			snippetMap["author_avatar"] = author.AvatarURL
-			snippetMap["author_github"] = author.GitHubURL
-			snippetMap["author_bio"] = author.Bio
-		}
-		result = append(result, snippetMap)
+	result, err := viewerSnippetMaps(c, snippets)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to check permissions"})
 	}
 	return c.JSON(result)
 }
 
+// Public: anyone may read public and unlisted snippets; signed-in callers
+// also get the viewer fields and may read what the policy allows them to
 func GetSnippet(c *fiber.Ctx) error {
 	id := c.Params("id")
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid snippet ID"})
 	}
-	var snippet models.Snippet
-	collection := utils.GetCollection("snippets")
-	err = collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&snippet)
+	snippet, err := authorizeSnippet(c, objectID, policy.ReadSnippet)
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "Snippet not found"})
-	}
-	// Populate author info
-	userCollection := utils.GetCollection("users")
-	var author models.User
-	snippetMap := make(map[string]interface{})
-	data, _ := bson.Marshal(snippet)
-	_ = bson.Unmarshal(data, &snippetMap)
-	if err := userCollection.FindOne(context.Background(), bson.M{"_id": snippet.AuthorID}).Decode(&author); err == nil {
-		snippetMap["author_username"] = author.Username
-		snippetMap["author_avatar"] = author.AvatarURL
-		snippetMap["author_github"] = author.GitHubURL
-		snippetMap["author_bio"] = author.Bio
-	}
-	return c.JSON(snippetMap)
+		return err
+	}
+	// Authors looking at their own snippets are not views
+	if user, ok := c.Locals("user").(models.User); !ok {
+		views.Record(objectID, views.AnonymousViewer(c.IP()))
+	} else if user.ID != snippet.AuthorID {
+		views.Record(objectID, views.UserViewer(user.ID))
+	}
+	// Populate author info and what the caller may do
+	result, err := viewerSnippetMaps(c, []models.Snippet{*snippet})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check permissions"})
+	}
+	return c.JSON(result[0])
 }
 
 func UpdateSnippet(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusNotImplemented)
 }
 
+// Replace a snippet's tags. Besides the author and moderators, members with
+// enough reputation may retag public snippets.
+func UpdateSnippetTags(c *fiber.Ctx) error {
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid snippet ID"})
+	}
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	tags, err := models.NormalizeTags(req.Tags)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := authorizeSnippet(c, objectID, policy.EditTags); err != nil {
+		return err
+	}
+	_, err = utils.GetCollection("snippets").UpdateByID(context.Background(), objectID, bson.M{
+		"$set": bson.M{"tags": tags, "updated_at": time.Now()},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update tags"})
+	}
+	return c.JSON(fiber.Map{"tags": tags})
+}
+
 func DeleteSnippet(c *fiber.Ctx) error {
 	snippetID := c.Params("id")
-	user, ok := c.Locals("user").(models.User)
-	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
-	}
 	objectID, err := primitive.ObjectIDFromHex(snippetID)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid snippet ID"})
 	}
-	collection := utils.GetCollection("snippets")
-	var snippet models.Snippet
-	err = collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&snippet)
+	snippet, err := authorizeSnippet(c, objectID, policy.DeleteSnippet)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Snippet not found"})
-	}
-	if snippet.AuthorID != user.ID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You are not the author of this snippet"})
+		return err
 	}
+	collection := utils.GetCollection("snippets")
 	_, err = collection.DeleteOne(context.Background(), bson.M{"_id": objectID})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete snippet"})
 	}
+	// A snippet only a moderator could remove was taken down, which costs
+	// the author reputation. Authors and organization maintainers curating
+	// their library are not moderating.
+	subject, err := currentSubject(c)
+	if err != nil {
+		log.Println("Failed to check moderation:", err)
+	} else if !snippet.AuthorID.IsZero() && policy.ActsAsModerator(subject, policy.DeleteSnippet, snippet) {
+		action := models.ModerationAction{
+			ID:          primitive.NewObjectID(),
+			UserID:      snippet.AuthorID,
+			ModeratorID: subject.User.ID,
+			Action:      models.ModerationSnippetRemoved,
+			SnippetID:   objectID,
+			CreatedAt:   time.Now(),
+		}
+		if _, err := utils.GetCollection("moderation_actions").InsertOne(context.Background(), action); err != nil {
+			log.Println("Failed to record moderation action:", err)
+		}
+		reputation.Notify(snippet.AuthorID)
+	}
 	return c.JSON(fiber.Map{"success": true})
 }
 
@@ -321,7 +428,10 @@ func GetBookmarks(c *fiber.Ctx) error {
 // Add a reaction to a snippet
 func AddSnippetReaction(c *fiber.Ctx) error {
 	snippetID := c.Params("id")
-	typeReq := c.Query("type") // useful, smart, refactored
+	typeReq := c.Query("type")
+	if !models.ValidReactionType(typeReq) {
+		return c.Status(400).JSON(fiber.Map{"error": "Reaction type must be useful, smart or refactored"})
+	}
 	user, ok := c.Locals("user").(models.User)
 	if !ok {
 		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
@@ -330,13 +440,10 @@ func AddSnippetReaction(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid snippet ID"})
 	}
-	collection := utils.GetCollection("snippets")
-	var snippet models.Snippet
-	err = collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&snippet)
+	snippet, err := authorizeSnippet(c, objectID, policy.ReactSnippet)
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "Snippet not found"})
+		return err
 	}
-	// Remove previous reaction by this user if exists
 	oldType := ""
 	for _, r := range snippet.Reactions {
 		if r.UserID == user.ID {
@@ -344,16 +451,46 @@ func AddSnippetReaction(c *fiber.Ctx) error {
 			break
 		}
 	}
-	if oldType != "" && oldType != typeReq {
-		// Decrement old type
-		_, _ = collection.UpdateByID(context.Background(), objectID, bson.M{"$inc": bson.M{oldType: -1}})
+	if oldType == typeReq {
+		return c.JSON(fiber.Map{"success": true})
+	}
+
+	// One update conditional on the reaction read above, so concurrent
+	// requests cannot add a second reaction or skew the counters
+	filter := bson.M{"_id": objectID}
+	var update bson.M
+	if oldType == "" {
+		filter["reactions.user_id"] = bson.M{"$ne": user.ID}
+		update = bson.M{
+			"$push": bson.M{"reactions": models.Reaction{UserID: user.ID, Type: typeReq}},
+			"$inc":  bson.M{typeReq: 1},
+			"$set":  bson.M{"updated_at": time.Now()},
+		}
+	} else {
+		filter["reactions"] = bson.M{"$elemMatch": bson.M{"user_id": user.ID, "type": oldType}}
+		inc := bson.M{typeReq: 1}
+		if models.ValidReactionType(oldType) {
+			inc[oldType] = -1
+		}
+		update = bson.M{
+			"$set": bson.M{"reactions.$.type": typeReq, "updated_at": time.Now()},
+			"$inc": inc,
+		}
+	}
+	result, err := utils.GetCollection("snippets").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update reaction"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "Reaction changed concurrently, try again"})
 	}
-	if oldType != typeReq {
-		// Remove old reaction and add new
-		_, _ = collection.UpdateByID(context.Background(), objectID, bson.M{"$pull": bson.M{"reactions": bson.M{"user_id": user.ID}}})
-		_, _ = collection.UpdateByID(context.Background(), objectID, bson.M{"$push": bson.M{"reactions": models.Reaction{UserID: user.ID, Type: typeReq}}})
-		_, _ = collection.UpdateByID(context.Background(), objectID, bson.M{"$inc": bson.M{typeReq: 1}, "$set": bson.M{"updated_at": time.Now()}})
+
+	// Authors reacting to their own snippets feed no rankings
+	if snippet.AuthorID != user.ID {
+		feeds.RecordEngagement(objectID, models.EngagementReaction, user.ID.Hex())
 	}
+	badges.Notify(snippet.AuthorID, badges.EventReactionReceived)
+	reputation.Notify(snippet.AuthorID)
 	return c.JSON(fiber.Map{"success": true})
 }
 
@@ -368,12 +505,11 @@ func ToggleBookmarkSnippet(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid snippet ID"})
 	}
-	collection := utils.GetCollection("snippets")
-	var snippet models.Snippet
-	err = collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&snippet)
+	snippet, err := authorizeSnippet(c, objectID, policy.BookmarkSnippet)
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "Snippet not found"})
+		return err
 	}
+	collection := utils.GetCollection("snippets")
 	isBookmarked := false
 	for _, uid := range snippet.BookmarkedBy {
 		if uid == user.ID {
@@ -391,6 +527,15 @@ func ToggleBookmarkSnippet(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to update bookmark"})
 	}
+	if !isBookmarked {
+		if snippet.AuthorID != user.ID {
+			feeds.RecordEngagement(objectID, models.EngagementBookmark, user.ID.Hex())
+		}
+		badges.Notify(snippet.AuthorID, badges.EventBookmarkReceived)
+	} else {
+		feeds.RemoveEngagement(objectID, models.EngagementBookmark, user.ID.Hex())
+	}
+	reputation.Notify(snippet.AuthorID)
 	return c.JSON(fiber.Map{"bookmarked": !isBookmarked})
 }
 
@@ -405,6 +550,10 @@ func AddSnippetComment(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid snippet ID"})
 	}
+	if _, err := authorizeSnippet(c, objectID, policy.CommentSnippet); err != nil {
+		return err
+	}
+	collection := utils.GetCollection("snippets")
 	var req struct {
 		Content  string `json:"content"`
 		ParentID string `json:"parentId"`
@@ -436,11 +585,12 @@ func AddSnippetComment(c *fiber.Ctx) error {
 	if user.GitHubURL != "" {
 		comment.GitHubURL = user.GitHubURL
 	}
-	collection := utils.GetCollection("snippets")
 	_, err = collection.UpdateByID(context.Background(), objectID, bson.M{"$push": bson.M{"comments": comment}})
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to add comment"})
 	}
+	feeds.RecordEngagement(objectID, models.EngagementComment, user.ID.Hex())
+	badges.Notify(user.ID, badges.EventCommented)
 	return c.JSON(comment)
 }
 
@@ -459,23 +609,7 @@ func GetUserSnippets(c *fiber.Ctx) error {
 	if err := cursor.All(context.Background(), &snippets); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to decode snippets"})
 	}
-	// Populate author info for each snippet (same as GetSnippets)
-	userCollection := utils.GetCollection("users")
-	var result []map[string]interface{}
-	for _, snip := range snippets {
-		snippetMap := make(map[string]interface{})
-		data, _ := bson.Marshal(snip)
-		_ = bson.Unmarshal(data, &snippetMap)
-		var author models.User
-		if err := userCollection.FindOne(context.Background(), bson.M{"_id": snip.AuthorID}).Decode(&author); err == nil {
-			snippetMap["author_username"] = author.Username
-			snippetMap["author_avatar"] = author.AvatarURL
-			snippetMap["author_github"] = author.GitHubURL
-			snippetMap["author_bio"] = author.Bio
-		}
-		result = append(result, snippetMap)
-	}
-	return c.JSON(result)
+	return c.JSON(snippetMaps(snippets))
 }
 
 // Get a user's bookmarked snippets
@@ -484,8 +618,15 @@ func GetUserBookmarkedSnippets(c *fiber.Ctx) error {
 	if !ok {
 		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
 	}
+	// Bookmarked snippets that have since been made private are hidden
+	subject, err := currentSubject(c)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch snippets"})
+	}
+	filter := readableSnippetsFilter(subject)
+	filter["bookmarked_by"] = user.ID
 	collection := utils.GetCollection("snippets")
-	cursor, err := collection.Find(context.Background(), bson.M{"bookmarked_by": user.ID})
+	cursor, err := collection.Find(context.Background(), filter)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch snippets"})
 	}
@@ -493,5 +634,8 @@ func GetUserBookmarkedSnippets(c *fiber.Ctx) error {
 	if err := cursor.All(context.Background(), &snippets); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to decode snippets"})
 	}
+	for i := range snippets {
+		snippets[i].Normalize()
+	}
 	return c.JSON(snippets)
 }
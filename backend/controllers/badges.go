@@ -0,0 +1,12 @@
+package controllers
+
+import (
+	"snippedia/badges"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// List every badge that can be earned and how
+func GetBadgeCatalog(c *fiber.Ctx) error {
+	return c.JSON(badges.Catalog)
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippedia/models"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// snippetFeed returns the snippets matching filter newest first, one page at
+// a time. Pages are addressed by an opaque ?cursor= naming the last snippet
+// of the previous page, so snippets posted meanwhile do not shift them.
+func snippetFeed(c *fiber.Ctx, filter bson.M) error {
+	_, limit := pageParams(c)
+	if raw := c.Query("cursor"); raw != "" {
+		createdAt, id, err := decodeFeedCursor(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid cursor"})
+		}
+		filter = bson.M{"$and": bson.A{filter, bson.M{"$or": bson.A{
+			bson.M{"created_at": bson.M{"$lt": createdAt}},
+			bson.M{"created_at": createdAt, "_id": bson.M{"$lt": id}},
+		}}}}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit) + 1)
+	cursor, err := utils.GetCollection("snippets").Find(context.Background(), filter, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch snippets"})
+	}
+	var snippets []models.Snippet
+	if err := cursor.All(context.Background(), &snippets); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode snippets"})
+	}
+
+	var next string
+	if len(snippets) > limit {
+		snippets = snippets[:limit]
+		last := snippets[limit-1]
+		next = encodeFeedCursor(last.CreatedAt, last.ID)
+	}
+	items, err := viewerSnippetMaps(c, snippets)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check permissions"})
+	}
+	if items == nil {
+		items = []map[string]interface{}{}
+	}
+	return c.JSON(fiber.Map{"items": items, "next_cursor": next})
+}
+
+func encodeFeedCursor(createdAt time.Time, id primitive.ObjectID) string {
+	raw := strconv.FormatInt(createdAt.UnixMilli(), 10) + ":" + id.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeFeedCursor(cursor string) (time.Time, primitive.ObjectID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, err
+	}
+	millis, hex, _ := strings.Cut(string(raw), ":")
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, err
+	}
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, err
+	}
+	return time.UnixMilli(ms), id, nil
+}
@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFeedCursorRoundTrip(t *testing.T) {
+	createdAt := time.UnixMilli(1700000000123)
+	id := primitive.NewObjectID()
+	gotTime, gotID, err := decodeFeedCursor(encodeFeedCursor(createdAt, id))
+	if err != nil {
+		t.Fatalf("decodeFeedCursor: %v", err)
+	}
+	if !gotTime.Equal(createdAt) || gotID != id {
+		t.Errorf("decodeFeedCursor = %v, %v; want %v, %v", gotTime, gotID, createdAt, id)
+	}
+}
+
+func TestDecodeFeedCursorRejectsMalformed(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	tests := map[string]string{
+		"empty":         "",
+		"not base64":    "!!!",
+		"no separator":  encode("1700000000123"),
+		"bad time":      encode("soon:" + primitive.NewObjectID().Hex()),
+		"bad id":        encode("1700000000123:nothex"),
+		"missing id":    encode("1700000000123:"),
+		"padded base64": base64.URLEncoding.EncodeToString([]byte("1:" + primitive.NewObjectID().Hex())),
+	}
+	for name, cursor := range tests {
+		if _, _, err := decodeFeedCursor(cursor); err == nil {
+			t.Errorf("%s: decodeFeedCursor(%q) succeeded", name, cursor)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"snippedia/models"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Follow a user
+func FollowUser(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	followee, err := findUserByUsername(c.Params("username"))
+	if err != nil {
+		return err
+	}
+	if followee.ID == user.ID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You cannot follow yourself"})
+	}
+	follow := models.Follow{
+		ID:         primitive.NewObjectID(),
+		FollowerID: user.ID,
+		FolloweeID: followee.ID,
+		CreatedAt:  time.Now(),
+	}
+	_, err = utils.GetCollection("follows").InsertOne(context.Background(), follow)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to follow user"})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// Stop following a user
+func UnfollowUser(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	followee, err := findUserByUsername(c.Params("username"))
+	if err != nil {
+		return err
+	}
+	_, err = utils.GetCollection("follows").DeleteOne(context.Background(), bson.M{
+		"follower_id": user.ID,
+		"followee_id": followee.ID,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unfollow user"})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// List the users following a user, most recent first
+func GetFollowers(c *fiber.Ctx) error {
+	return followList(c, "followee_id", "follower_id")
+}
+
+// List the users a user follows, most recent first
+func GetFollowing(c *fiber.Ctx) error {
+	return followList(c, "follower_id", "followee_id")
+}
+
+// followList pages through the follows whose by field is the user named in
+// the route and returns the users in their other field
+func followList(c *fiber.Ctx, by, other string) error {
+	user, err := findUserByUsername(c.Params("username"))
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	page, limit := pageParams(c)
+	filter := bson.M{by: user.ID}
+	collection := utils.GetCollection("follows")
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch follows"})
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch follows"})
+	}
+	var follows []models.Follow
+	if err := cursor.All(ctx, &follows); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode follows"})
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(follows))
+	for _, f := range follows {
+		if other == "follower_id" {
+			ids = append(ids, f.FollowerID)
+		} else {
+			ids = append(ids, f.FolloweeID)
+		}
+	}
+	users, err := usersByID(ids)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch users"})
+	}
+	items := make([]fiber.Map, 0, len(ids))
+	for i, id := range ids {
+		u, ok := users[id]
+		if !ok {
+			continue
+		}
+		items = append(items, fiber.Map{
+			"id":           u.ID,
+			"username":     u.Username,
+			"display_name": u.Profile.DisplayName,
+			"avatar_url":   u.AvatarURL,
+			"followed_at":  follows[i].CreatedAt,
+		})
+	}
+	return c.JSON(fiber.Map{"items": items, "page": page, "limit": limit, "total": total})
+}
+
+// Recent public snippets by the people the caller follows, newest first.
+// Pass the returned next_cursor as ?cursor= to get the following page.
+func GetFollowingFeed(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	followees, err := followeeIDs(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch follows"})
+	}
+	filter := listedSnippetsFilter()
+	filter["author_id"] = bson.M{"$in": followees}
+	return snippetFeed(c, filter)
+}
+
+// followeeIDs lists the IDs of the users someone follows
+func followeeIDs(followerID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	values, err := utils.GetCollection("follows").Distinct(context.Background(), "followee_id", bson.M{"follower_id": followerID})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// followCounts returns how many followers the user has and how many users
+// they follow
+func followCounts(userID primitive.ObjectID) (followers, following int64, err error) {
+	collection := utils.GetCollection("follows")
+	followers, err = collection.CountDocuments(context.Background(), bson.M{"followee_id": userID})
+	if err != nil {
+		return 0, 0, err
+	}
+	following, err = collection.CountDocuments(context.Background(), bson.M{"follower_id": userID})
+	return followers, following, err
+}
+
+// isFollowing reports whether follower follows followee
+func isFollowing(followerID, followeeID primitive.ObjectID) (bool, error) {
+	count, err := utils.GetCollection("follows").CountDocuments(context.Background(), bson.M{
+		"follower_id": followerID,
+		"followee_id": followeeID,
+	})
+	return count > 0, err
+}
+
+// findUserByUsername loads a user, failing with a *fiber.Error
+func findUserByUsername(username string) (*models.User, error) {
+	var user models.User
+	err := utils.GetCollection("users").FindOne(context.Background(), bson.M{"username": username}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fiber.NewError(fiber.StatusNotFound, "User not found")
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch user")
+	}
+	return &user, nil
+}
+
+// usersByID loads the users with the given IDs
+func usersByID(ids []primitive.ObjectID) (map[primitive.ObjectID]models.User, error) {
+	cursor, err := utils.GetCollection("users").Find(context.Background(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := cursor.All(context.Background(), &users); err != nil {
+		return nil, err
+	}
+	result := make(map[primitive.ObjectID]models.User, len(users))
+	for _, u := range users {
+		result[u.ID] = u
+	}
+	return result, nil
+}
@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"snippedia/auth"
+	"snippedia/config"
+	"snippedia/models"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// List the identities linked to the caller's account
+func GetUserIdentities(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := utils.GetCollection("identities").Find(context.Background(), bson.M{"user_id": user.ID}, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch identities"})
+	}
+	identities := []models.Identity{}
+	if err := cursor.All(context.Background(), &identities); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode identities"})
+	}
+	return c.JSON(identities)
+}
+
+// Start linking another provider account to the caller's account. The
+// link is bound to this browser through the signed state cookie set here, so
+// the returned URL is useless to anyone else. Call it with credentials so
+// the cookie is stored, then send the browser to the URL.
+func LinkIdentity(cfg *config.Config) fiber.Handler {
+	providers := auth.Providers(cfg)
+	return func(c *fiber.Ctx) error {
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+		provider, ok := providers[c.Params("provider")]
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown login provider"})
+		}
+		authURL, err := startOAuth(c, cfg, provider, user.ID.Hex())
+		if err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"url": authURL})
+	}
+}
+
+// Unlink an identity from the caller's account. The last identity cannot be
+// removed, or the account could never be signed into again.
+func UnlinkIdentity(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	identityID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid identity ID"})
+	}
+	// Delete first and put the identity back if it was the last one, so
+	// parallel unlinks cannot both pass a count taken beforehand
+	ctx := context.Background()
+	collection := utils.GetCollection("identities")
+	var identity models.Identity
+	err = collection.FindOneAndDelete(ctx, bson.M{"_id": identityID, "user_id": user.ID}).Decode(&identity)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Identity not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unlink identity"})
+	}
+	count, err := collection.CountDocuments(ctx, bson.M{"user_id": user.ID})
+	if err != nil || count == 0 {
+		if _, restoreErr := collection.InsertOne(ctx, identity); restoreErr != nil {
+			log.Println("Failed to restore identity:", restoreErr)
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unlink identity"})
+		}
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "You cannot unlink your only sign-in method"})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// finishIdentityLink attaches the provider account to the user who started
+// the link flow and sends the browser back to the profile page
+func finishIdentityLink(c *fiber.Ctx, cfg *config.Config, linkUserID, provider string, profile *auth.Profile, existing *models.Identity) error {
+	profileURL := cfg.FrontendURL + "/profile"
+	userID, err := primitive.ObjectIDFromHex(linkUserID)
+	if err != nil {
+		return c.Redirect(profileURL + "?link_error=invalid_request")
+	}
+	if existing != nil {
+		if existing.UserID != userID {
+			// Moving an identity between accounts would let whoever controls
+			// it take over the other account's sign-in
+			return c.Redirect(profileURL + "?link_error=already_linked")
+		}
+		touchIdentity(existing.ID, profile)
+		return c.Redirect(profileURL + "?linked=" + provider)
+	}
+	if _, err := createIdentity(userID, provider, profile); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Redirect(profileURL + "?link_error=already_linked")
+		}
+		return c.Redirect(profileURL + "?link_error=failed")
+	}
+	return c.Redirect(profileURL + "?linked=" + provider)
+}
+
+// findIdentity returns the identity of a provider account, or nil if the
+// account has never signed in
+func findIdentity(provider, providerUserID string) (*models.Identity, error) {
+	var identity models.Identity
+	err := utils.GetCollection("identities").FindOne(context.Background(), bson.M{
+		"provider":         provider,
+		"provider_user_id": providerUserID,
+	}).Decode(&identity)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func createIdentity(userID primitive.ObjectID, provider string, profile *auth.Profile) (*models.Identity, error) {
+	now := time.Now()
+	identity := models.Identity{
+		ID:             primitive.NewObjectID(),
+		UserID:         userID,
+		Provider:       provider,
+		ProviderUserID: profile.ID,
+		Username:       profile.Username,
+		Email:          profile.Email,
+		CreatedAt:      now,
+		LastUsedAt:     now,
+	}
+	if _, err := utils.GetCollection("identities").InsertOne(context.Background(), identity); err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// touchIdentity records a sign-in and the account's current username and email
+func touchIdentity(identityID primitive.ObjectID, profile *auth.Profile) {
+	_, _ = utils.GetCollection("identities").UpdateByID(context.Background(), identityID, bson.M{"$set": bson.M{
+		"username":     profile.Username,
+		"email":        profile.Email,
+		"last_used_at": time.Now(),
+	}})
+}
@@ -0,0 +1,14 @@
+package controllers
+
+import (
+	"snippedia/auth"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Publish the public keys access tokens are signed with, so other services
+// can verify them
+func GetJWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(fiber.Map{"keys": auth.JWKS()})
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"context"
+
+	"snippedia/config"
+	"snippedia/feeds"
+	"snippedia/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Authors whose public snippets received the most reactions and bookmarks.
+// ?period= is week, month or all (the default); ?language= and ?tag= limit
+// it to snippets in a language or with a tag.
+func GetAuthorLeaderboard(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		board, err := leaderboard(c, cfg, models.LeaderboardAuthors)
+		if err != nil {
+			return err
+		}
+		users, err := usersByID(entryIDs(board.Entries))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch users"})
+		}
+		items := make([]fiber.Map, 0, len(board.Entries))
+		for _, e := range board.Entries {
+			u, ok := users[e.ID]
+			if !ok {
+				continue
+			}
+			items = append(items, fiber.Map{
+				"rank": len(items) + 1,
+				"user": fiber.Map{
+					"id":           u.ID,
+					"username":     u.Username,
+					"display_name": u.Profile.DisplayName,
+					"avatar_url":   u.AvatarURL,
+				},
+				"score":     e.Score,
+				"reactions": e.Reactions,
+				"bookmarks": e.Bookmarks,
+			})
+		}
+		return c.JSON(leaderboardResponse(board, items))
+	}
+}
+
+// Public snippets that received the most reactions and bookmarks. Takes the
+// same parameters as GetAuthorLeaderboard.
+func GetSnippetLeaderboard(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		board, err := leaderboard(c, cfg, models.LeaderboardSnippets)
+		if err != nil {
+			return err
+		}
+		ordered, err := listedSnippetsInOrder(context.Background(), entryIDs(board.Entries))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch snippets"})
+		}
+		entries := make(map[primitive.ObjectID]models.LeaderboardEntry, len(board.Entries))
+		for _, e := range board.Entries {
+			entries[e.ID] = e
+		}
+		snippets, err := viewerSnippetMaps(c, ordered)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check permissions"})
+		}
+		items := make([]fiber.Map, 0, len(snippets))
+		for i, s := range snippets {
+			e := entries[ordered[i].ID]
+			items = append(items, fiber.Map{
+				"rank":      i + 1,
+				"snippet":   s,
+				"score":     e.Score,
+				"reactions": e.Reactions,
+				"bookmarks": e.Bookmarks,
+			})
+		}
+		return c.JSON(leaderboardResponse(board, items))
+	}
+}
+
+// leaderboard reads the period and filters from the query and fetches the
+// leaderboard of kind, failing with a *fiber.Error
+func leaderboard(c *fiber.Ctx, cfg *config.Config, kind string) (*models.Leaderboard, error) {
+	period := c.Query("period", models.PeriodAllTime)
+	if !models.ValidPeriod(period) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "period must be week, month or all")
+	}
+	language, tag := c.Query("language"), c.Query("tag")
+	if len(language) > models.MaxTopicLength || len(tag) > models.MaxTopicLength {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid filter")
+	}
+	board, err := feeds.Leaderboard(context.Background(), cfg, kind, period, language, tag)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to fetch leaderboard")
+	}
+	return board, nil
+}
+
+func leaderboardResponse(board *models.Leaderboard, items []fiber.Map) fiber.Map {
+	return fiber.Map{
+		"period":      board.Period,
+		"language":    board.Language,
+		"tag":         board.Tag,
+		"items":       items,
+		"computed_at": board.ComputedAt,
+	}
+}
+
+func entryIDs(entries []models.LeaderboardEntry) []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"snippedia/auth"
+	"snippedia/config"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	oauthStateCookie   = "oauth_state"
+	oauthStateLifetime = 10 * time.Minute
+)
+
+// oauthState is kept in a signed, HttpOnly cookie between the login redirect
+// and the callback. State protects the callback against CSRF and login
+// fixation; Verifier is the PKCE code verifier. LinkUserID is set when the
+// flow links a new identity to that user instead of signing in.
+type oauthState struct {
+	Provider   string `json:"provider"`
+	State      string `json:"state"`
+	Verifier   string `json:"verifier"`
+	LinkUserID string `json:"link_user_id,omitempty"`
+	ExpiresAt  int64  `json:"exp"`
+}
+
+// List the login providers that are configured
+func GetOAuthProviders(cfg *config.Config) fiber.Handler {
+	names := []string{}
+	for name := range auth.Providers(cfg) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"providers": names})
+	}
+}
+
+// Start a login: remember a fresh state and PKCE verifier and send the
+// browser to the provider's consent screen
+func OAuthLogin(cfg *config.Config) fiber.Handler {
+	providers := auth.Providers(cfg)
+	return func(c *fiber.Ctx) error {
+		provider, ok := providers[c.Params("provider")]
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown login provider"})
+		}
+		authURL, err := startOAuth(c, cfg, provider, "")
+		if err != nil {
+			return err
+		}
+		return c.Redirect(authURL)
+	}
+}
+
+// startOAuth stores a fresh state and PKCE verifier in the signed state
+// cookie and returns the provider's consent screen URL. A non-empty
+// linkUserID makes the callback link the identity to that user. Failures are
+// returned as *fiber.Error.
+func startOAuth(c *fiber.Ctx, cfg *config.Config, provider auth.Provider, linkUserID string) (string, error) {
+	state, err := utils.RandomToken(32)
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusInternalServerError, "Failed to start login")
+	}
+	verifier, err := utils.RandomToken(32)
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusInternalServerError, "Failed to start login")
+	}
+	expires := time.Now().Add(oauthStateLifetime)
+	cookie, err := signOAuthState(cfg.StateSecret, oauthState{
+		Provider:   provider.Name(),
+		State:      state,
+		Verifier:   verifier,
+		LinkUserID: linkUserID,
+		ExpiresAt:  expires.Unix(),
+	})
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusInternalServerError, "Failed to start login")
+	}
+	// Cross-site when linking from the frontend; the callback itself is a
+	// top-level redirect back from the provider
+	setCookie(c, cfg, oauthStateCookie, cookie, "/auth", expires)
+
+	authURL, err := provider.AuthURL(context.Background(), state, pkceChallenge(verifier), oauthRedirectURI(cfg, provider))
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusBadGateway, "Login provider is unavailable")
+	}
+	return authURL, nil
+}
+
+// oauthRedirectURI is the callback URL registered with the provider
+func oauthRedirectURI(cfg *config.Config, provider auth.Provider) string {
+	return cfg.PublicURL + "/auth/" + provider.Name() + "/callback"
+}
+
+// consumeOAuthState checks the state returned to the callback against the
+// signed cookie set by OAuthLogin, clears the cookie and returns what the
+// cookie carried
+func consumeOAuthState(c *fiber.Ctx, secret, provider string) (*oauthState, error) {
+	cookie := c.Cookies(oauthStateCookie)
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthStateCookie,
+		Value:    "",
+		Path:     "/auth",
+		Expires:  time.Unix(0, 0),
+		HTTPOnly: true,
+	})
+	if cookie == "" {
+		return nil, errors.New("missing login state")
+	}
+	stored, err := verifyOAuthState(secret, cookie)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Provider != provider {
+		return nil, errors.New("login state belongs to another provider")
+	}
+	if time.Now().Unix() > stored.ExpiresAt {
+		return nil, errors.New("login state expired")
+	}
+	state := c.Query("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(stored.State)) != 1 {
+		return nil, errors.New("login state mismatch")
+	}
+	return &stored, nil
+}
+
+func signOAuthState(secret string, s oauthState) (string, error) {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + oauthStateMAC(secret, encoded), nil
+}
+
+func verifyOAuthState(secret, value string) (oauthState, error) {
+	var s oauthState
+	encoded, mac, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(mac), []byte(oauthStateMAC(secret, encoded))) {
+		return s, errors.New("invalid login state signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(payload, &s)
+	return s, err
+}
+
+func oauthStateMAC(secret, encoded string) string {
+	mac := hmac.New(sha256.New, []byte("oauth-state:"+secret))
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// pkceChallenge derives the S256 code challenge from a PKCE verifier
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"snippedia/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const testStateSecret = "test-state-secret-that-is-long-enough"
+
+// fakeGitHub is a GitHub OAuth server that records the token requests it
+// receives. Its user endpoint refuses every token, so a callback that gets
+// past the state check stops right after the code exchange, before it needs
+// the database.
+type fakeGitHub struct {
+	*httptest.Server
+	cfg      *config.Config
+	mu       sync.Mutex
+	requests []url.Values
+}
+
+func newFakeGitHub(t *testing.T) *fakeGitHub {
+	t.Helper()
+	f := &fakeGitHub{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.requests = append(f.requests, r.PostForm)
+		f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "gho_test"})
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Bad credentials", http.StatusUnauthorized)
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+
+	f.cfg = &config.Config{
+		PublicURL:          "http://api.test",
+		StateSecret:        testStateSecret,
+		GitHubClientID:     "client-id",
+		GitHubClientSecret: "client-secret",
+		GitHubURL:          f.URL,
+		GitHubAPIURL:       f.URL,
+	}
+	return f
+}
+
+func (f *fakeGitHub) tokenRequests() []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]url.Values(nil), f.requests...)
+}
+
+func oauthApp(cfg *config.Config) *fiber.App {
+	app := fiber.New()
+	app.Get("/auth/:provider/login", OAuthLogin(cfg))
+	app.Get("/auth/:provider/callback", OAuthCallback(cfg))
+	return app
+}
+
+// startLogin begins a GitHub login and returns the state cookie and the
+// query of the consent screen URL the browser was sent to
+func startLogin(t *testing.T, app *fiber.App, github *fakeGitHub) (*http.Cookie, url.Values) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest("GET", "/auth/github/login", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("login status = %d, want %d", resp.StatusCode, fiber.StatusFound)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != github.URL+"/login/oauth/authorize" {
+		t.Fatalf("login redirects to %s", got)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == oauthStateCookie {
+			if !cookie.HttpOnly || cookie.Path != "/auth" {
+				t.Errorf("state cookie is not HttpOnly and scoped to /auth: %+v", cookie)
+			}
+			return cookie, location.Query()
+		}
+	}
+	t.Fatal("login did not set the state cookie")
+	return nil, nil
+}
+
+func callback(t *testing.T, app *fiber.App, cookie *http.Cookie, query url.Values) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/auth/github/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestOAuthLoginSendsPKCEChallenge(t *testing.T) {
+	github := newFakeGitHub(t)
+	_, params := startLogin(t, oauthApp(github.cfg), github)
+	want := map[string]string{
+		"client_id":             "client-id",
+		"redirect_uri":          "http://api.test/auth/github/callback",
+		"response_type":         "code",
+		"code_challenge_method": "S256",
+	}
+	for key, value := range want {
+		if got := params.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if params.Get("state") == "" || params.Get("code_challenge") == "" {
+		t.Errorf("state or code challenge missing: %v", params)
+	}
+}
+
+func TestOAuthCallbackWithValidState(t *testing.T) {
+	github := newFakeGitHub(t)
+	app := oauthApp(github.cfg)
+	cookie, params := startLogin(t, app, github)
+
+	resp := callback(t, app, cookie, url.Values{"code": {"the-code"}, "state": {params.Get("state")}})
+	// The fake refuses the profile request once the code is exchanged
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Fatalf("status = %d, want the profile failure after the exchange", resp.StatusCode)
+	}
+	requests := github.tokenRequests()
+	if len(requests) != 1 {
+		t.Fatalf("token endpoint called %d times, want 1", len(requests))
+	}
+	form := requests[0]
+	if form.Get("code") != "the-code" || form.Get("redirect_uri") != params.Get("redirect_uri") {
+		t.Errorf("token request = %v", form)
+	}
+	// The verifier sent with the code must be the one the challenge was
+	// derived from
+	verifier := form.Get("code_verifier")
+	if verifier == "" || pkceChallenge(verifier) != params.Get("code_challenge") {
+		t.Errorf("code_verifier %q does not match challenge %q", verifier, params.Get("code_challenge"))
+	}
+
+	// The state can only be used once
+	for _, c := range resp.Cookies() {
+		if c.Name == oauthStateCookie && c.Value != "" {
+			t.Errorf("callback did not clear the state cookie: %+v", c)
+		}
+	}
+}
+
+func TestOAuthCallbackRejectsBadState(t *testing.T) {
+	github := newFakeGitHub(t)
+	app := oauthApp(github.cfg)
+	cookie, params := startLogin(t, app, github)
+	state := params.Get("state")
+	stored, err := verifyOAuthState(testStateSecret, cookie.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withValue := func(value string) *http.Cookie {
+		return &http.Cookie{Name: oauthStateCookie, Value: value}
+	}
+	resign := func(secret string, change func(*oauthState)) *http.Cookie {
+		s := stored
+		change(&s)
+		value, err := signOAuthState(secret, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return withValue(value)
+	}
+	// The payload swapped for another one under the original signature
+	tampered := func() *http.Cookie {
+		s := stored
+		s.State = "attacker-state"
+		payload, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, mac, _ := strings.Cut(cookie.Value, ".")
+		return withValue(base64.RawURLEncoding.EncodeToString(payload) + "." + mac)
+	}
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		state  string
+	}{
+		{"missing cookie", nil, state},
+		{"empty cookie", withValue(""), state},
+		{"unsigned cookie", withValue(strings.SplitN(cookie.Value, ".", 2)[0]), state},
+		{"tampered cookie", tampered(), "attacker-state"},
+		{"cookie signed with another secret", resign("another-secret", func(*oauthState) {}), state},
+		{"cookie for another provider", resign(testStateSecret, func(s *oauthState) { s.Provider = "gitlab" }), state},
+		{"expired cookie", resign(testStateSecret, func(s *oauthState) {
+			s.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+		}), state},
+		{"state mismatch", cookie, "attacker-state"},
+		{"missing state", cookie, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{"code": {"the-code"}}
+			if tt.state != "" {
+				query.Set("state", tt.state)
+			}
+			resp := callback(t, app, tt.cookie, query)
+			if resp.StatusCode != fiber.StatusBadRequest {
+				t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusBadRequest)
+			}
+		})
+	}
+	if n := len(github.tokenRequests()); n != 0 {
+		t.Errorf("token endpoint called %d times for rejected states", n)
+	}
+}
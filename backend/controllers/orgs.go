@@ -0,0 +1,476 @@
+package controllers
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"snippedia/models"
+	"snippedia/policy"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const invitationLifetime = 14 * 24 * time.Hour
+
+var orgSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,38}$`)
+
+// Create an organization owned by the caller
+func CreateOrg(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	var req struct {
+		Slug        string `json:"slug"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	if !orgSlugPattern.MatchString(req.Slug) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Slug must be 2-39 lowercase letters, digits or dashes"})
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		req.Name = req.Slug
+	}
+	now := time.Now()
+	org := models.Organization{
+		ID:          primitive.NewObjectID(),
+		Slug:        req.Slug,
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Members:     []models.OrgMember{{UserID: user.ID, Role: models.OrgRoleOwner, JoinedAt: now}},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	_, err := utils.GetCollection("organizations").InsertOne(context.Background(), org)
+	if mongo.IsDuplicateKeyError(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Slug is already taken"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create organization"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(org)
+}
+
+// Get an organization with its members
+func GetOrg(c *fiber.Ctx) error {
+	org := c.Locals("org").(models.Organization)
+	members, err := orgMemberMaps(org.Members)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch members"})
+	}
+	return c.JSON(fiber.Map{
+		"id":          org.ID,
+		"slug":        org.Slug,
+		"name":        org.Name,
+		"description": org.Description,
+		"members":     members,
+		"role":        c.Locals("org_role"),
+		"created_at":  org.CreatedAt,
+	})
+}
+
+// Update the name and description of an organization
+func UpdateOrg(c *fiber.Ctx) error {
+	org := c.Locals("org").(models.Organization)
+	var req struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	set := bson.M{"updated_at": time.Now()}
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Name cannot be empty"})
+		}
+		set["name"] = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		set["description"] = *req.Description
+	}
+	_, err := utils.GetCollection("organizations").UpdateByID(context.Background(), org.ID, bson.M{"$set": set})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update organization"})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// List the organizations the caller belongs to
+func GetUserOrgs(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	cursor, err := utils.GetCollection("organizations").Find(context.Background(), bson.M{"members.user_id": user.ID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch organizations"})
+	}
+	var orgs []models.Organization
+	if err := cursor.All(context.Background(), &orgs); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode organizations"})
+	}
+	result := make([]fiber.Map, 0, len(orgs))
+	for _, org := range orgs {
+		result = append(result, fiber.Map{
+			"id":           org.ID,
+			"slug":         org.Slug,
+			"name":         org.Name,
+			"description":  org.Description,
+			"role":         org.RoleOf(user.ID),
+			"member_count": len(org.Members),
+		})
+	}
+	return c.JSON(result)
+}
+
+// Change the role of a member. Owners only.
+func UpdateOrgMember(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	org := c.Locals("org").(models.Organization)
+	memberID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&req); err != nil || !models.ValidOrgRole(req.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid role"})
+	}
+	current := org.RoleOf(memberID)
+	if current == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Member not found"})
+	}
+	membership := policy.OrgMembership{Org: &org, UserID: memberID, Role: req.Role}
+	if !policy.Can(policy.Subject{User: &user}, policy.ChangeMemberRole, membership) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Your role in this organization does not allow this"})
+	}
+	demotesOwner := current == models.OrgRoleOwner && req.Role != models.OrgRoleOwner
+	if demotesOwner && org.OwnerCount() == 1 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "An organization needs at least one owner"})
+	}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"member.user_id": memberID}},
+	})
+	result, err := utils.GetCollection("organizations").UpdateOne(context.Background(),
+		membershipFilter(org.ID, memberID, current, demotesOwner),
+		bson.M{"$set": bson.M{"members.$[member].role": req.Role, "updated_at": time.Now()}},
+		opts,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update member"})
+	}
+	if result.MatchedCount == 0 {
+		return membershipConflict(c, demotesOwner)
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// Remove a member from an organization. Members may remove themselves;
+// maintainers may remove members and owners may remove anyone.
+func RemoveOrgMember(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	org := c.Locals("org").(models.Organization)
+	memberID, err := primitive.ObjectIDFromHex(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+	role := org.RoleOf(memberID)
+	if role == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Member not found"})
+	}
+	membership := policy.OrgMembership{Org: &org, UserID: memberID, Role: role}
+	if !policy.Can(policy.Subject{User: &user}, policy.RemoveMember, membership) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Your role in this organization does not allow this"})
+	}
+	removesOwner := role == models.OrgRoleOwner
+	if removesOwner && org.OwnerCount() == 1 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "An organization needs at least one owner"})
+	}
+	result, err := utils.GetCollection("organizations").UpdateOne(context.Background(),
+		membershipFilter(org.ID, memberID, role, removesOwner),
+		bson.M{
+			"$pull": bson.M{"members": bson.M{"user_id": memberID}},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove member"})
+	}
+	if result.MatchedCount == 0 {
+		return membershipConflict(c, removesOwner)
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// membershipFilter matches the organization only while the member still
+// holds role and, if another owner is required, while one remains. Checking
+// this in the update itself keeps concurrent requests from removing or
+// demoting the last owner.
+func membershipFilter(orgID, memberID primitive.ObjectID, role string, otherOwner bool) bson.M {
+	conditions := bson.A{
+		bson.M{"members": bson.M{"$elemMatch": bson.M{"user_id": memberID, "role": role}}},
+	}
+	if otherOwner {
+		conditions = append(conditions, bson.M{"members": bson.M{"$elemMatch": bson.M{
+			"user_id": bson.M{"$ne": memberID},
+			"role":    models.OrgRoleOwner,
+		}}})
+	}
+	return bson.M{"_id": orgID, "$and": conditions}
+}
+
+// membershipConflict answers a membership change whose filter no longer
+// matched
+func membershipConflict(c *fiber.Ctx, otherOwner bool) error {
+	if otherOwner {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "An organization needs at least one owner"})
+	}
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "The membership changed meanwhile, please try again"})
+}
+
+// Invite a user to an organization by username. Maintainers and owners only;
+// only owners can invite other owners.
+func CreateOrgInvitation(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	org := c.Locals("org").(models.Organization)
+	var req struct {
+		Username string `json:"username"`
+		Role     string `json:"role"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if req.Role == "" {
+		req.Role = models.OrgRoleMember
+	}
+	if !models.ValidOrgRole(req.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid role"})
+	}
+	membership := policy.OrgMembership{Org: &org, Role: req.Role}
+	if !policy.Can(policy.Subject{User: &user}, policy.InviteMember, membership) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You cannot invite members with a higher role than your own"})
+	}
+	var invitee models.User
+	err := utils.GetCollection("users").FindOne(context.Background(), bson.M{"username": req.Username}).Decode(&invitee)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if org.RoleOf(invitee.ID) != "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "User is already a member"})
+	}
+	collection := utils.GetCollection("org_invitations")
+	pending, err := collection.CountDocuments(context.Background(), bson.M{
+		"org_id":     org.ID,
+		"invitee_id": invitee.ID,
+		"status":     models.InvitationPending,
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create invitation"})
+	}
+	if pending > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "User already has a pending invitation"})
+	}
+	now := time.Now()
+	invitation := models.OrgInvitation{
+		ID:        primitive.NewObjectID(),
+		OrgID:     org.ID,
+		InviterID: user.ID,
+		InviteeID: invitee.ID,
+		Role:      req.Role,
+		Status:    models.InvitationPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(invitationLifetime),
+	}
+	if _, err := collection.InsertOne(context.Background(), invitation); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create invitation"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(invitation)
+}
+
+// List the pending invitations of an organization
+func GetOrgInvitations(c *fiber.Ctx) error {
+	org := c.Locals("org").(models.Organization)
+	invitations, err := findInvitations(bson.M{"org_id": org.ID, "status": models.InvitationPending})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch invitations"})
+	}
+	return c.JSON(invitations)
+}
+
+// Revoke a pending invitation of an organization
+func RevokeOrgInvitation(c *fiber.Ctx) error {
+	org := c.Locals("org").(models.Organization)
+	invitationID, err := primitive.ObjectIDFromHex(c.Params("invitationId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid invitation ID"})
+	}
+	result, err := utils.GetCollection("org_invitations").UpdateOne(context.Background(),
+		bson.M{"_id": invitationID, "org_id": org.ID, "status": models.InvitationPending},
+		bson.M{"$set": bson.M{"status": models.InvitationRevoked}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke invitation"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Invitation not found"})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// List the caller's pending invitations
+func GetUserInvitations(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	invitations, err := findInvitations(bson.M{
+		"invitee_id": user.ID,
+		"status":     models.InvitationPending,
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch invitations"})
+	}
+	return c.JSON(invitations)
+}
+
+// Accept an invitation and join the organization
+func AcceptInvitation(c *fiber.Ctx) error {
+	return respondToInvitation(c, true)
+}
+
+// Decline an invitation
+func DeclineInvitation(c *fiber.Ctx) error {
+	return respondToInvitation(c, false)
+}
+
+func respondToInvitation(c *fiber.Ctx, accept bool) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	invitationID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid invitation ID"})
+	}
+	collection := utils.GetCollection("org_invitations")
+	var invitation models.OrgInvitation
+	err = collection.FindOne(context.Background(), bson.M{
+		"_id":        invitationID,
+		"invitee_id": user.ID,
+		"status":     models.InvitationPending,
+	}).Decode(&invitation)
+	if err != nil || time.Now().After(invitation.ExpiresAt) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Invitation not found"})
+	}
+
+	status := models.InvitationDeclined
+	if accept {
+		status = models.InvitationAccepted
+		member := models.OrgMember{UserID: user.ID, Role: invitation.Role, JoinedAt: time.Now()}
+		_, err = utils.GetCollection("organizations").UpdateOne(context.Background(),
+			bson.M{"_id": invitation.OrgID, "members.user_id": bson.M{"$ne": user.ID}},
+			bson.M{"$push": bson.M{"members": member}, "$set": bson.M{"updated_at": time.Now()}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to join organization"})
+		}
+	}
+	_, err = collection.UpdateByID(context.Background(), invitation.ID, bson.M{"$set": bson.M{"status": status}})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update invitation"})
+	}
+	return c.JSON(fiber.Map{"success": true, "status": status})
+}
+
+// List and search the snippets of an organization, newest first. Supports
+// ?q= to search titles, descriptions and tags and ?language= to filter.
+func GetOrgSnippets(c *fiber.Ctx) error {
+	org := c.Locals("org").(models.Organization)
+	subject, err := currentSubject(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check permissions"})
+	}
+	conditions := bson.A{readableSnippetsFilter(subject)}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"title": pattern},
+			bson.M{"description": pattern},
+			bson.M{"tags": pattern},
+		}})
+	}
+	filter := bson.M{"org_id": org.ID, "$and": conditions}
+	if language := strings.ToLower(strings.TrimSpace(c.Query("language"))); language != "" {
+		filter["language"] = language
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := utils.GetCollection("snippets").Find(context.Background(), filter, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch snippets"})
+	}
+	var snippets []models.Snippet
+	if err := cursor.All(context.Background(), &snippets); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode snippets"})
+	}
+	return c.JSON(snippetMaps(snippets))
+}
+
+func findInvitations(filter bson.M) ([]models.OrgInvitation, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := utils.GetCollection("org_invitations").Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	invitations := []models.OrgInvitation{}
+	if err := cursor.All(context.Background(), &invitations); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// orgMemberMaps joins organization members with their public user info
+func orgMemberMaps(members []models.OrgMember) ([]fiber.Map, error) {
+	ids := make([]primitive.ObjectID, 0, len(members))
+	for _, m := range members {
+		ids = append(ids, m.UserID)
+	}
+	cursor, err := utils.GetCollection("users").Find(context.Background(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := cursor.All(context.Background(), &users); err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]models.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+	result := make([]fiber.Map, 0, len(members))
+	for _, m := range members {
+		u := byID[m.UserID]
+		result = append(result, fiber.Map{
+			"user_id":    m.UserID,
+			"username":   u.Username,
+			"avatar_url": u.AvatarURL,
+			"role":       m.Role,
+			"joined_at":  m.JoinedAt,
+		})
+	}
+	return result, nil
+}
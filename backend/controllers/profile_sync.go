@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"snippedia/auth"
+	"snippedia/models"
+	"snippedia/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// maxUsernameSuffix bounds the search for a free username
+	maxUsernameSuffix = 100
+
+	// maxUsernameAttempts bounds retries when a free username is taken
+	// before the new user is stored
+	maxUsernameAttempts = 5
+)
+
+// syncProfile updates the provider-owned fields of a returning user from the
+// provider profile and records the login. Everything else on the user, such
+// as badges, bookmarks and fields the user has edited, is left alone.
+func syncProfile(ctx context.Context, user *models.User, identity *models.Identity, profile *auth.Profile) error {
+	now := time.Now()
+	set := bson.M{
+		"last_login_at": now,
+		"updated_at":    now,
+	}
+	if profile.AvatarURL != "" {
+		set["avatar_url"] = profile.AvatarURL
+	}
+	if !user.HasEdited(models.FieldBio) {
+		set["bio"] = profile.Bio
+	}
+	// Other identities may carry other addresses; keep the one we have
+	if user.Email == "" && profile.Email != "" {
+		set["email"] = profile.Email
+	}
+	if identity.Provider == "github" {
+		if id, err := strconv.Atoi(profile.ID); err == nil {
+			set["github_id"] = id
+		}
+		if profile.ProfileURL != "" {
+			set["github_url"] = profile.ProfileURL
+		}
+	}
+
+	// Follow a rename on the provider, but only when the user still goes by
+	// their provider username and the new one is free. Accounts are keyed
+	// by the provider's stable user ID, so a rename never creates a new one.
+	renamed := identity.Username != "" && profile.Username != "" &&
+		profile.Username != identity.Username && user.Username == identity.Username
+	if renamed {
+		available, err := usernameAvailable(ctx, profile.Username)
+		if err != nil {
+			return err
+		}
+		if available {
+			set["username"] = profile.Username
+		}
+	}
+
+	collection := utils.GetCollection("users")
+	_, err := collection.UpdateByID(ctx, user.ID, bson.M{"$set": set})
+	if mongo.IsDuplicateKeyError(err) {
+		// Someone took the new username in the meantime
+		delete(set, "username")
+		_, err = collection.UpdateByID(ctx, user.ID, bson.M{"$set": set})
+	}
+	return err
+}
+
+// insertUser stores a new user under base or the lowest free variant of it.
+// Two signups can pick the same free name at once; the unique index turns
+// the loser away and it moves on to the next one.
+func insertUser(ctx context.Context, user *models.User, base string) (primitive.ObjectID, error) {
+	for attempt := 0; attempt < maxUsernameAttempts; attempt++ {
+		username, err := uniqueUsername(ctx, base)
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+		user.Username = username
+		result, err := utils.GetCollection("users").InsertOne(ctx, user)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+		return result.InsertedID.(primitive.ObjectID), nil
+	}
+	return primitive.NilObjectID, errors.New("no free username for " + base)
+}
+
+// uniqueUsername returns base if no user has it yet, or else base with the
+// lowest free numeric suffix
+func uniqueUsername(ctx context.Context, base string) (string, error) {
+	if base == "" {
+		base = "user"
+	}
+	for i := 1; i <= maxUsernameSuffix; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = base + "-" + strconv.Itoa(i)
+		}
+		available, err := usernameAvailable(ctx, candidate)
+		if err != nil {
+			return "", err
+		}
+		if available {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("no free username for " + base)
+}
+
+func usernameAvailable(ctx context.Context, username string) (bool, error) {
+	count, err := utils.GetCollection("users").CountDocuments(ctx, bson.M{"username": username})
+	return count == 0, err
+}
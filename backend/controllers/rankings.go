@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"snippedia/models"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Snippets gathering the most engagement for their age
+func GetHotFeed(c *fiber.Ctx) error {
+	return rankedFeed(c, models.RankingHot)
+}
+
+// Snippets gathering the most engagement lately
+func GetTrendingFeed(c *fiber.Ctx) error {
+	return rankedFeed(c, models.RankingTrending)
+}
+
+// rankedFeed serves a page of a precomputed ranking
+func rankedFeed(c *fiber.Ctx, name string) error {
+	ctx := context.Background()
+	page, limit := pageParams(c)
+	ranking, err := loadRanking(ctx, name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch ranking"})
+	}
+
+	total := len(ranking.SnippetIDs)
+	start := (page - 1) * limit
+	if start > total {
+		start = total
+	}
+	end := start + limit
+	if end > total {
+		end = total
+	}
+	ordered, err := listedSnippetsInOrder(ctx, ranking.SnippetIDs[start:end])
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch snippets"})
+	}
+
+	items, err := viewerSnippetMaps(c, ordered)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check permissions"})
+	}
+	if items == nil {
+		items = []map[string]interface{}{}
+	}
+	var computedAt *time.Time
+	if !ranking.ComputedAt.IsZero() {
+		computedAt = &ranking.ComputedAt
+	}
+	return c.JSON(fiber.Map{
+		"items":       items,
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"computed_at": computedAt,
+	})
+}
+
+// loadRanking returns the precomputed ranking, empty if it was never computed
+func loadRanking(ctx context.Context, name string) (models.Ranking, error) {
+	var ranking models.Ranking
+	err := utils.GetCollection("rankings").FindOne(ctx, bson.M{"_id": name}).Decode(&ranking)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ranking, nil
+	}
+	return ranking, err
+}
+
+// listedSnippetsInOrder loads the snippets with the given IDs that are
+// still listed, in the order of ids
+func listedSnippetsInOrder(ctx context.Context, ids []primitive.ObjectID) ([]models.Snippet, error) {
+	filter := listedSnippetsFilter()
+	filter["_id"] = bson.M{"$in": ids}
+	cursor, err := utils.GetCollection("snippets").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var found []models.Snippet
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]models.Snippet, len(found))
+	for _, s := range found {
+		byID[s.ID] = s
+	}
+	ordered := make([]models.Snippet, 0, len(found))
+	for _, id := range ids {
+		if s, ok := byID[id]; ok {
+			ordered = append(ordered, s)
+		}
+	}
+	return ordered, nil
+}
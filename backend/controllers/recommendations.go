@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+
+	"snippedia/feeds"
+	"snippedia/models"
+	"snippedia/policy"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Public snippets most like a snippet the caller can read
+func GetRelatedSnippets(c *fiber.Ctx) error {
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid snippet ID"})
+	}
+	snippet, err := authorizeSnippet(c, objectID, policy.ReadSnippet)
+	if err != nil {
+		return err
+	}
+	_, limit := pageParams(c)
+	related, err := feeds.Related(context.Background(), snippet, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to find related snippets"})
+	}
+	return recommendationList(c, related)
+}
+
+// Snippets picked for the caller from what they bookmark, react to and
+// follow. Callers without any of that yet get the trending feed.
+func GetForYouFeed(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	ctx := context.Background()
+	_, limit := pageParams(c)
+	picks, err := feeds.ForYou(ctx, &user, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to find recommendations"})
+	}
+	if len(picks) == 0 {
+		ranking, err := loadRanking(ctx, models.RankingTrending)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch ranking"})
+		}
+		ids := ranking.SnippetIDs
+		if len(ids) > limit {
+			ids = ids[:limit]
+		}
+		if picks, err = listedSnippetsInOrder(ctx, ids); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch snippets"})
+		}
+	}
+	return recommendationList(c, picks)
+}
+
+func recommendationList(c *fiber.Ctx, snippets []models.Snippet) error {
+	items, err := viewerSnippetMaps(c, snippets)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check permissions"})
+	}
+	if items == nil {
+		items = []map[string]interface{}{}
+	}
+	return c.JSON(fiber.Map{"items": items})
+}
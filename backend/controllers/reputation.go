@@ -0,0 +1,12 @@
+package controllers
+
+import (
+	"snippedia/reputation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// List the privileges reputation unlocks and how much each needs
+func GetReputationPrivileges(c *fiber.Ctx) error {
+	return c.JSON(reputation.Privileges)
+}
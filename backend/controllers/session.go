@@ -0,0 +1,351 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"snippedia/auth"
+	"snippedia/config"
+	"snippedia/models"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const authCodeLifetime = time.Minute
+
+var errSessionEnded = errors.New("session has ended")
+
+// completeLogin hands a session for the user to the frontend, either as a
+// one-time code in the redirect or as HttpOnly cookies. Tokens never appear
+// in a URL.
+func completeLogin(c *fiber.Ctx, cfg *config.Config, userID primitive.ObjectID) error {
+	if cfg.SessionMode == config.SessionModeCookie {
+		tokens, err := startSession(c, cfg, userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start session"})
+		}
+		setSessionCookies(c, cfg, tokens)
+		return c.Redirect(cfg.FrontendURL + "/feed")
+	}
+
+	code, err := utils.RandomToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate code"})
+	}
+	authCode := models.AuthCode{
+		ID:        primitive.NewObjectID(),
+		CodeHash:  utils.HashToken(code),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(authCodeLifetime),
+	}
+	if _, err := utils.GetCollection("auth_codes").InsertOne(context.Background(), authCode); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate code"})
+	}
+	return c.Redirect(cfg.FrontendURL + "/?auth_code=" + code)
+}
+
+// Exchange a one-time login code for an access and refresh token
+func ExchangeAuthCode(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req struct {
+			Code string `json:"code"`
+		}
+		if err := c.BodyParser(&req); err != nil || req.Code == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Code is required"})
+		}
+		var authCode models.AuthCode
+		err := utils.GetCollection("auth_codes").FindOneAndDelete(context.Background(), bson.M{
+			"code_hash":  utils.HashToken(req.Code),
+			"expires_at": bson.M{"$gt": time.Now()},
+		}).Decode(&authCode)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired code"})
+		}
+		// The session starts here rather than in the callback so that it
+		// records the device that will actually use it
+		tokens, err := startSession(c, cfg, authCode.UserID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start session"})
+		}
+		return c.JSON(tokens.response(cfg))
+	}
+}
+
+// Trade a refresh token for a new access token and a new refresh token. The
+// old refresh token stops working; presenting it again ends the session, as
+// it means the token was stolen.
+func RefreshSession(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+			}
+		}
+		if req.RefreshToken == "" {
+			token, err := refreshCookie(c)
+			if err != nil {
+				return err
+			}
+			req.RefreshToken = token
+		}
+		if req.RefreshToken == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Refresh token is required"})
+		}
+		tokens, err := rotateSession(c, cfg, req.RefreshToken)
+		if err != nil {
+			if cfg.SessionMode == config.SessionModeCookie {
+				clearSessionCookies(c, cfg)
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Session has ended, please log in again"})
+		}
+		if cfg.SessionMode == config.SessionModeCookie {
+			setSessionCookies(c, cfg, tokens)
+			return c.JSON(fiber.Map{"success": true, "expires_in": int(cfg.AccessTokenTTL.Seconds())})
+		}
+		return c.JSON(tokens.response(cfg))
+	}
+}
+
+// Log out: end the session the refresh token belongs to and clear cookies
+func Logout(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if len(c.Body()) > 0 {
+			_ = c.BodyParser(&req)
+		}
+		if req.RefreshToken == "" {
+			token, err := refreshCookie(c)
+			if err != nil {
+				return err
+			}
+			req.RefreshToken = token
+		}
+		if req.RefreshToken != "" {
+			_, _ = utils.GetCollection("sessions").UpdateOne(context.Background(),
+				bson.M{"refresh_token_hash": utils.HashToken(req.RefreshToken)},
+				bson.M{"$set": bson.M{"revoked": true}},
+			)
+		}
+		clearSessionCookies(c, cfg)
+		return c.JSON(fiber.Map{"success": true})
+	}
+}
+
+// refreshCookie returns the refresh token cookie. Like the session cookie
+// in AuthMiddleware, it only counts on requests carrying X-Requested-With,
+// which other sites cannot send without a CORS preflight.
+func refreshCookie(c *fiber.Ctx) (string, error) {
+	token := c.Cookies(config.RefreshCookie)
+	if token != "" && c.Get("X-Requested-With") == "" {
+		return "", fiber.NewError(fiber.StatusForbidden, "X-Requested-With header is required")
+	}
+	return token, nil
+}
+
+// List the caller's active sessions
+func GetSessions(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	current, _ := c.Locals("session_id").(primitive.ObjectID)
+	opts := options.Find().SetSort(bson.D{{Key: "last_used_at", Value: -1}})
+	cursor, err := utils.GetCollection("sessions").Find(context.Background(), bson.M{
+		"user_id":    user.ID,
+		"revoked":    false,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch sessions"})
+	}
+	var sessions []models.Session
+	if err := cursor.All(context.Background(), &sessions); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode sessions"})
+	}
+	result := make([]fiber.Map, 0, len(sessions))
+	for _, s := range sessions {
+		result = append(result, fiber.Map{
+			"id":           s.ID,
+			"user_agent":   s.UserAgent,
+			"ip":           s.IP,
+			"created_at":   s.CreatedAt,
+			"last_used_at": s.LastUsedAt,
+			"expires_at":   s.ExpiresAt,
+			"current":      s.ID == current,
+		})
+	}
+	return c.JSON(result)
+}
+
+// End one of the caller's sessions. Its tokens stop working immediately.
+func RevokeSession(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	sessionID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session ID"})
+	}
+	result, err := utils.GetCollection("sessions").UpdateOne(context.Background(),
+		bson.M{"_id": sessionID, "user_id": user.ID, "revoked": false},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke session"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// End every session of the caller, including the current one
+func RevokeAllSessions(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+		result, err := utils.GetCollection("sessions").UpdateMany(context.Background(),
+			bson.M{"user_id": user.ID, "revoked": false},
+			bson.M{"$set": bson.M{"revoked": true}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke sessions"})
+		}
+		clearSessionCookies(c, cfg)
+		return c.JSON(fiber.Map{"success": true, "revoked": result.ModifiedCount})
+	}
+}
+
+// sessionTokens is what a client holds for a session
+type sessionTokens struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+func (t sessionTokens) response(cfg *config.Config) fiber.Map {
+	return fiber.Map{
+		"token":         t.AccessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(cfg.AccessTokenTTL.Seconds()),
+		"refresh_token": t.RefreshToken,
+	}
+}
+
+// startSession records a new session for the requesting device and issues
+// its first tokens
+func startSession(c *fiber.Ctx, cfg *config.Config, userID primitive.ObjectID) (sessionTokens, error) {
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	now := time.Now()
+	session := models.Session{
+		ID:               primitive.NewObjectID(),
+		UserID:           userID,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		UserAgent:        c.Get(fiber.HeaderUserAgent),
+		IP:               c.IP(),
+		CreatedAt:        now,
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(cfg.RefreshTokenTTL),
+	}
+	if _, err := utils.GetCollection("sessions").InsertOne(context.Background(), session); err != nil {
+		return sessionTokens{}, err
+	}
+	accessToken, err := auth.IssueAccessToken(cfg, userID, session.ID)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	return sessionTokens{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// rotateSession swaps a refresh token for a new pair of tokens
+func rotateSession(c *fiber.Ctx, cfg *config.Config, refreshToken string) (sessionTokens, error) {
+	collection := utils.GetCollection("sessions")
+	hash := utils.HashToken(refreshToken)
+
+	// A token that was already rotated away is being replayed: whoever
+	// holds the current one may be an attacker, so end the session
+	replayed, err := collection.UpdateOne(context.Background(),
+		bson.M{"previous_token_hash": hash},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	if replayed.MatchedCount > 0 {
+		return sessionTokens{}, errSessionEnded
+	}
+
+	newRefreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	var session models.Session
+	err = collection.FindOneAndUpdate(context.Background(),
+		bson.M{
+			"refresh_token_hash": hash,
+			"revoked":            false,
+			"expires_at":         bson.M{"$gt": time.Now()},
+		},
+		bson.M{"$set": bson.M{
+			"refresh_token_hash":  utils.HashToken(newRefreshToken),
+			"previous_token_hash": hash,
+			"last_used_at":        time.Now(),
+			"user_agent":          c.Get(fiber.HeaderUserAgent),
+			"ip":                  c.IP(),
+		}},
+	).Decode(&session)
+	if err != nil {
+		return sessionTokens{}, errSessionEnded
+	}
+	accessToken, err := auth.IssueAccessToken(cfg, session.UserID, session.ID)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	return sessionTokens{AccessToken: accessToken, RefreshToken: newRefreshToken}, nil
+}
+
+func setSessionCookies(c *fiber.Ctx, cfg *config.Config, tokens sessionTokens) {
+	now := time.Now()
+	setCookie(c, cfg, config.SessionCookie, tokens.AccessToken, "/", now.Add(cfg.AccessTokenTTL))
+	// The refresh token is only ever needed by the /auth endpoints
+	setCookie(c, cfg, config.RefreshCookie, tokens.RefreshToken, "/auth", now.Add(cfg.RefreshTokenTTL))
+}
+
+func clearSessionCookies(c *fiber.Ctx, cfg *config.Config) {
+	setCookie(c, cfg, config.SessionCookie, "", "/", time.Unix(0, 0))
+	setCookie(c, cfg, config.RefreshCookie, "", "/auth", time.Unix(0, 0))
+}
+
+func setCookie(c *fiber.Ctx, cfg *config.Config, name, value, path string, expires time.Time) {
+	secure := strings.HasPrefix(cfg.PublicURL, "https://")
+	sameSite := fiber.CookieSameSiteLaxMode
+	if secure {
+		// The frontend is usually served from another site
+		sameSite = fiber.CookieSameSiteNoneMode
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Expires:  expires,
+		Secure:   secure,
+		HTTPOnly: true,
+		SameSite: sameSite,
+	})
+}
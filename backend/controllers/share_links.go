@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"snippedia/models"
+	"snippedia/policy"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxShareLinkHours bounds how long a share link can stay valid: a year
+const maxShareLinkHours = 24 * 365
+
+// Mint a secret share link for a snippet. Authors only.
+func CreateShareLink(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid snippet ID"})
+	}
+	if _, err := authorizeSnippet(c, objectID, policy.ShareSnippet); err != nil {
+		return err
+	}
+	var req struct {
+		ExpiresInHours int `json:"expires_in_hours"`
+		MaxViews       int `json:"max_views"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+		}
+	}
+	if req.ExpiresInHours < 0 || req.MaxViews < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Expiry and view limit cannot be negative"})
+	}
+	if req.ExpiresInHours > maxShareLinkHours {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Share links can last a year at most"})
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	}
+	link := models.ShareLink{
+		ID:        primitive.NewObjectID(),
+		TokenHash: utils.HashToken(token),
+		SnippetID: objectID,
+		CreatorID: user.ID,
+		MaxViews:  req.MaxViews,
+		CreatedAt: time.Now(),
+	}
+	if req.ExpiresInHours > 0 {
+		expiresAt := link.CreatedAt.Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		link.ExpiresAt = &expiresAt
+	}
+	if _, err := utils.GetCollection("share_links").InsertOne(context.Background(), link); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create share link"})
+	}
+	// The token is only ever returned here; we keep just its hash
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"link":  link,
+		"token": token,
+		"path":  "/s/" + token,
+	})
+}
+
+// List the share links of a snippet. Authors only.
+func GetShareLinks(c *fiber.Ctx) error {
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid snippet ID"})
+	}
+	if _, err := authorizeSnippet(c, objectID, policy.ShareSnippet); err != nil {
+		return err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := utils.GetCollection("share_links").Find(context.Background(), bson.M{"snippet_id": objectID}, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch share links"})
+	}
+	links := []models.ShareLink{}
+	if err := cursor.All(context.Background(), &links); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode share links"})
+	}
+	return c.JSON(links)
+}
+
+// Revoke a share link. Authors only.
+func RevokeShareLink(c *fiber.Ctx) error {
+	objectID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid snippet ID"})
+	}
+	linkID, err := primitive.ObjectIDFromHex(c.Params("linkId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid share link ID"})
+	}
+	if _, err := authorizeSnippet(c, objectID, policy.ShareSnippet); err != nil {
+		return err
+	}
+	result, err := utils.GetCollection("share_links").UpdateOne(context.Background(),
+		bson.M{"_id": linkID, "snippet_id": objectID},
+		bson.M{"$set": bson.M{"revoked": true}},
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke share link"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Share link not found"})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// Resolve a share link to its snippet. Public: the token is the credential,
+// and it grants access to that one snippet only. Each resolution counts as a
+// view against the link's limit.
+func ResolveShareLink(c *fiber.Ctx) error {
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": utils.HashToken(c.Params("token")),
+		"revoked":    false,
+		"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"expires_at": nil},
+				bson.M{"expires_at": bson.M{"$gt": now}},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{"max_views": 0},
+				bson.M{"$expr": bson.M{"$lt": bson.A{"$views", "$max_views"}}},
+			}},
+		},
+	}
+	var link models.ShareLink
+	err := utils.GetCollection("share_links").FindOneAndUpdate(context.Background(), filter,
+		bson.M{"$inc": bson.M{"views": 1}},
+	).Decode(&link)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Share link not found or expired"})
+	}
+	var snippet models.Snippet
+	err = utils.GetCollection("snippets").FindOne(context.Background(), bson.M{"_id": link.SnippetID}).Decode(&snippet)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Snippet not found"})
+	}
+	return c.JSON(snippetMaps([]models.Snippet{snippet})[0])
+}
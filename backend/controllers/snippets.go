@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"context"
+
+	"snippedia/models"
+	"snippedia/policy"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// snippetMaps normalizes snippets and populates the author info of each one
+// for API responses
+func snippetMaps(snippets []models.Snippet) []map[string]interface{} {
+	userCollection := utils.GetCollection("users")
+	var result []map[string]interface{}
+	for _, snip := range snippets {
+		snip.Normalize()
+		snippetMap := make(map[string]interface{})
+		data, _ := bson.Marshal(snip)
+		_ = bson.Unmarshal(data, &snippetMap)
+		var author models.User
+		if err := userCollection.FindOne(context.Background(), bson.M{"_id": snip.AuthorID}).Decode(&author); err == nil {
+			snippetMap["author_username"] = author.Username
+			snippetMap["author_avatar"] = author.AvatarURL
+			snippetMap["author_github"] = author.GitHubURL
+			snippetMap["author_bio"] = author.Bio
+		}
+		result = append(result, snippetMap)
+	}
+	return result
+}
+
+// viewerSnippetMaps is snippetMaps plus a "viewer" object per snippet with
+// what the caller has done with it and may do to it. Anonymous callers get
+// the same object with everything unset.
+func viewerSnippetMaps(c *fiber.Ctx, snippets []models.Snippet) ([]map[string]interface{}, error) {
+	subject, err := currentSubject(c)
+	if err != nil {
+		return nil, err
+	}
+	result := snippetMaps(snippets)
+	for i := range snippets {
+		snip := &snippets[i]
+		viewer := fiber.Map{
+			"bookmarked": false,
+			"reaction":   "",
+			"can_update": policy.Can(subject, policy.UpdateSnippet, snip),
+			"can_delete": policy.Can(subject, policy.DeleteSnippet, snip),
+			"can_share":  policy.Can(subject, policy.ShareSnippet, snip),
+		}
+		if subject.User != nil {
+			for _, id := range snip.BookmarkedBy {
+				if id == subject.User.ID {
+					viewer["bookmarked"] = true
+					break
+				}
+			}
+			for _, r := range snip.Reactions {
+				if r.UserID == subject.User.ID {
+					viewer["reaction"] = r.Type
+					break
+				}
+			}
+		}
+		result[i]["viewer"] = viewer
+	}
+	return result, nil
+}
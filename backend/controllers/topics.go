@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"snippedia/feeds"
+	"snippedia/models"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// topicFields maps the :kind route parameter to the field of FollowedTopics
+var topicFields = map[string]string{
+	"tags":      "topics.tags",
+	"languages": "topics.languages",
+}
+
+// List the tags and languages the caller follows
+func GetFollowedTopics(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	topics := user.Topics
+	if topics.Tags == nil {
+		topics.Tags = []string{}
+	}
+	if topics.Languages == nil {
+		topics.Languages = []string{}
+	}
+	return c.JSON(topics)
+}
+
+// Follow a tag or language: PUT /user/topics/tags/:name or
+// /user/topics/languages/:name
+func FollowTopic(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	field, name, err := topicParams(c)
+	if err != nil {
+		return err
+	}
+	// The limit is checked in the update so parallel requests cannot pass
+	// it together; topics already followed can always be followed again
+	result, err := utils.GetCollection("users").UpdateOne(context.Background(),
+		bson.M{"_id": user.ID, "$or": bson.A{
+			bson.M{field: name},
+			bson.M{field + "." + strconv.Itoa(models.MaxFollowedTopics-1): bson.M{"$exists": false}},
+		}},
+		bson.M{"$addToSet": bson.M{field: name}})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to follow topic"})
+	}
+	if result.MatchedCount == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You follow too many topics of this kind"})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// Stop following a tag or language
+func UnfollowTopic(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	field, name, err := topicParams(c)
+	if err != nil {
+		return err
+	}
+	_, err = utils.GetCollection("users").UpdateByID(context.Background(), user.ID,
+		bson.M{"$pull": bson.M{field: name}})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to unfollow topic"})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// Choose how often to get a digest of new snippets in followed topics
+func UpdateDigestFrequency(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	var req struct {
+		Frequency string `json:"frequency"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if !models.ValidDigestFrequency(req.Frequency) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Frequency must be empty, daily or weekly"})
+	}
+	_, err := utils.GetCollection("users").UpdateByID(context.Background(), user.ID,
+		bson.M{"$set": bson.M{"topics.digest_frequency": req.Frequency}})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update digest"})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// Recent public snippets in the tags and languages the caller follows,
+// newest first, paginated like the following feed
+func GetTopicFeed(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	topics := feeds.TopicFilter(user.Topics)
+	if topics == nil {
+		return c.JSON(fiber.Map{"items": []interface{}{}, "next_cursor": ""})
+	}
+	return snippetFeed(c, bson.M{"$and": bson.A{listedSnippetsFilter(), topics}})
+}
+
+// topicParams reads the followed topics field and the normalized topic name
+// from the route, failing with a *fiber.Error
+func topicParams(c *fiber.Ctx) (string, string, error) {
+	field, ok := topicFields[c.Params("kind")]
+	if !ok {
+		return "", "", fiber.NewError(fiber.StatusNotFound, "Unknown topic kind")
+	}
+	// Names like "c#" arrive escaped
+	name, err := url.PathUnescape(c.Params("name"))
+	if err != nil {
+		return "", "", fiber.NewError(fiber.StatusBadRequest, "Invalid topic name")
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || len(name) > models.MaxTopicLength {
+		return "", "", fiber.NewError(fiber.StatusBadRequest, "Invalid topic name")
+	}
+	return field, name, nil
+}
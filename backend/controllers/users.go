@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+
+	"snippedia/models"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Return a user's public profile with a page of their public snippets.
+// Public: nothing private such as email or bookmarks is included.
+func GetPublicProfile(c *fiber.Ctx) error {
+	ctx := context.Background()
+	user, err := findUserByUsername(c.Params("username"))
+	if err != nil {
+		return err
+	}
+
+	page, limit := pageParams(c)
+	filter := listedSnippetsFilter()
+	filter["author_id"] = user.ID
+	collection := utils.GetCollection("snippets")
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch snippets"})
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch snippets"})
+	}
+	var snippets []models.Snippet
+	if err := cursor.All(ctx, &snippets); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode snippets"})
+	}
+	snippetList, err := viewerSnippetMaps(c, snippets)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check permissions"})
+	}
+	if snippetList == nil {
+		snippetList = []map[string]interface{}{}
+	}
+
+	reactions, err := reactionTotals(ctx, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to count reactions"})
+	}
+
+	followers, following, err := followCounts(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to count follows"})
+	}
+	viewerFollows := false
+	if viewer, ok := c.Locals("user").(models.User); ok {
+		if viewerFollows, err = isFollowing(viewer.ID, user.ID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check follows"})
+		}
+	}
+
+	badges := user.Badges
+	if badges == nil {
+		badges = []models.AwardedBadge{}
+	}
+	return c.JSON(fiber.Map{
+		"user": fiber.Map{
+			"id":                  user.ID.Hex(),
+			"username":            user.Username,
+			"display_name":        user.Profile.DisplayName,
+			"avatar_url":          user.AvatarURL,
+			"bio":                 user.Bio,
+			"github_url":          user.GitHubURL,
+			"location":            user.Profile.Location,
+			"website":             user.Profile.Website,
+			"pronouns":            user.Profile.Pronouns,
+			"preferred_languages": user.Profile.PreferredLanguages,
+			"badges":              badges,
+			"reputation":          user.Reputation,
+			"joined_at":           user.CreatedAt,
+			"followers":           followers,
+			"following":           following,
+		},
+		"viewer":             fiber.Map{"following": viewerFollows},
+		"reactions_received": reactions,
+		"snippets": fiber.Map{
+			"items": snippetList,
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// reactionTotals sums the reactions the user received on their public
+// snippets
+func reactionTotals(ctx context.Context, userID primitive.ObjectID) (fiber.Map, error) {
+	match := listedSnippetsFilter()
+	match["author_id"] = userID
+	cursor, err := utils.GetCollection("snippets").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        nil,
+			"useful":     bson.M{"$sum": "$useful"},
+			"smart":      bson.M{"$sum": "$smart"},
+			"refactored": bson.M{"$sum": "$refactored"},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var totals []struct {
+		Useful     int `bson:"useful"`
+		Smart      int `bson:"smart"`
+		Refactored int `bson:"refactored"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return nil, err
+	}
+	result := fiber.Map{"useful": 0, "smart": 0, "refactored": 0}
+	if len(totals) > 0 {
+		result["useful"] = totals[0].Useful
+		result["smart"] = totals[0].Smart
+		result["refactored"] = totals[0].Refactored
+	}
+	return result, nil
+}
@@ -0,0 +1,115 @@
+package feeds
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"snippedia/models"
+	"snippedia/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// digestCheck is how often the digest job looks for digests that are due
+	digestCheck = time.Hour
+
+	// digestSnippets is how many snippets a digest links to
+	digestSnippets = 10
+)
+
+// StartDigests sends topic digests in the background
+func StartDigests() {
+	go func() {
+		ticker := time.NewTicker(digestCheck)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := SendDigests(context.Background()); err != nil {
+				log.Println("Failed to send topic digests:", err)
+			}
+		}
+	}()
+}
+
+// SendDigests notifies every user whose digest is due about the public
+// snippets posted in their followed topics since their last digest
+func SendDigests(ctx context.Context) error {
+	cursor, err := utils.GetCollection("users").Find(ctx, bson.M{
+		"topics.digest_frequency": bson.M{"$in": bson.A{models.DigestDaily, models.DigestWeekly}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+		if err := sendDigest(ctx, user); err != nil {
+			log.Printf("Failed to send topic digest to %s: %v", user.Username, err)
+		}
+	}
+	return cursor.Err()
+}
+
+func sendDigest(ctx context.Context, user models.User) error {
+	now := time.Now()
+	period := models.DigestPeriod(user.Topics.DigestFrequency)
+	since := now.Add(-period)
+	if last := user.Topics.LastDigestAt; last != nil {
+		if now.Sub(*last) < period {
+			return nil
+		}
+		since = *last
+	}
+
+	if topics := TopicFilter(user.Topics); topics != nil {
+		filter := bson.M{
+			"$and": bson.A{topics, bson.M{
+				"visibility": models.VisibilityPublic,
+				"author_id":  bson.M{"$ne": user.ID},
+				"created_at": bson.M{"$gt": since, "$lte": now},
+			}},
+		}
+		snippets := utils.GetCollection("snippets")
+		count, err := snippets.CountDocuments(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			opts := options.Find().
+				SetSort(bson.D{{Key: "created_at", Value: -1}}).
+				SetLimit(digestSnippets).
+				SetProjection(bson.M{"_id": 1})
+			cursor, err := snippets.Find(ctx, filter, opts)
+			if err != nil {
+				return err
+			}
+			var found []models.Snippet
+			if err := cursor.All(ctx, &found); err != nil {
+				return err
+			}
+			notification := models.Notification{
+				ID:        primitive.NewObjectID(),
+				UserID:    user.ID,
+				Type:      models.NotificationTopicDigest,
+				Count:     int(count),
+				Since:     since,
+				CreatedAt: now,
+			}
+			for _, s := range found {
+				notification.SnippetIDs = append(notification.SnippetIDs, s.ID)
+			}
+			if _, err := utils.GetCollection("notifications").InsertOne(ctx, notification); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := utils.GetCollection("users").UpdateByID(ctx, user.ID,
+		bson.M{"$set": bson.M{"topics.last_digest_at": now}})
+	return err
+}
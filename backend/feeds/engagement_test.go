@@ -0,0 +1,222 @@
+package feeds
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"snippedia/migrations"
+	"snippedia/models"
+	"snippedia/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testMongoEnv names the MongoDB tests that need a database run against.
+// Each test gets a fresh database on it that is dropped afterwards.
+const testMongoEnv = "SNIPPEDIA_TEST_MONGO_URI"
+
+func useTestDB(t *testing.T) context.Context {
+	t.Helper()
+	uri := os.Getenv(testMongoEnv)
+	if uri == "" {
+		t.Skip(testMongoEnv + " is not set")
+	}
+	ctx := context.Background()
+	if err := utils.ConnectDB(uri, "snippedia_test_"+primitive.NewObjectID().Hex()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		utils.DB.Drop(context.Background())
+		utils.DB.Client().Disconnect(context.Background())
+	})
+	if err := migrations.Run(utils.DB); err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+func insertSnippet(t *testing.T, ctx context.Context, authorID primitive.ObjectID) primitive.ObjectID {
+	t.Helper()
+	snippet := models.Snippet{
+		ID:         primitive.NewObjectID(),
+		Title:      "ranked",
+		Language:   "go",
+		Tags:       []string{"ranking"},
+		Visibility: models.VisibilityPublic,
+		AuthorID:   authorID,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if _, err := utils.GetCollection("snippets").InsertOne(ctx, snippet); err != nil {
+		t.Fatal(err)
+	}
+	return snippet.ID
+}
+
+func loadScore(t *testing.T, ctx context.Context, id primitive.ObjectID) models.SnippetScore {
+	t.Helper()
+	var score models.SnippetScore
+	if err := utils.GetCollection("snippet_scores").FindOne(ctx, bson.M{"_id": id}).Decode(&score); err != nil {
+		t.Fatal(err)
+	}
+	return score
+}
+
+func TestToggledBookmarkIsScoredOnce(t *testing.T) {
+	ctx := useTestDB(t)
+	cfg := rankingConfig()
+	snippetID := insertSnippet(t, ctx, primitive.NewObjectID())
+	actor := primitive.NewObjectID().Hex()
+
+	RecordEngagement(snippetID, models.EngagementBookmark, actor)
+	// Score as if the events have settled
+	later := time.Now().Add(2 * eventSettle)
+	checkpoint, err := scoreEvents(ctx, cfg, primitive.NilObjectID, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := loadScore(t, ctx, snippetID)
+	if first.Engagement != cfg.Ranking.BookmarkWeight {
+		t.Fatalf("engagement = %v, want %v", first.Engagement, cfg.Ranking.BookmarkWeight)
+	}
+
+	for i := 0; i < 5; i++ {
+		RemoveEngagement(snippetID, models.EngagementBookmark, actor)
+		RecordEngagement(snippetID, models.EngagementBookmark, actor)
+	}
+	if _, err := scoreEvents(ctx, cfg, checkpoint, later.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadScore(t, ctx, snippetID); got.Engagement != first.Engagement {
+		t.Errorf("engagement grew from %v to %v by toggling a bookmark", first.Engagement, got.Engagement)
+	}
+
+	count, err := utils.GetCollection("engagement_events").CountDocuments(ctx, bson.M{"snippet_id": snippetID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("%d events recorded, want 1", count)
+	}
+}
+
+func TestWithdrawnBookmarkLeavesLeaderboard(t *testing.T) {
+	ctx := useTestDB(t)
+	cfg := rankingConfig()
+	snippetID := insertSnippet(t, ctx, primitive.NewObjectID())
+	actor := primitive.NewObjectID().Hex()
+
+	RecordEngagement(snippetID, models.EngagementBookmark, actor)
+	RemoveEngagement(snippetID, models.EngagementBookmark, actor)
+	board, err := computeLeaderboard(ctx, cfg, models.LeaderboardSnippets, models.PeriodAllTime, "", "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(board.Entries) != 0 {
+		t.Errorf("withdrawn bookmark still ranked: %+v", board.Entries)
+	}
+
+	RecordEngagement(snippetID, models.EngagementBookmark, actor)
+	board, err = computeLeaderboard(ctx, cfg, models.LeaderboardSnippets, models.PeriodAllTime, "", "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(board.Entries) != 1 || board.Entries[0].Bookmarks != 1 {
+		t.Errorf("restored bookmark ranked as %+v, want one bookmark", board.Entries)
+	}
+}
+
+func TestRetriedScoringSkipsScoredEvents(t *testing.T) {
+	ctx := useTestDB(t)
+	cfg := rankingConfig()
+	snippetID := insertSnippet(t, ctx, primitive.NewObjectID())
+	RecordEngagement(snippetID, models.EngagementBookmark, primitive.NewObjectID().Hex())
+	RecordEngagement(snippetID, models.EngagementReaction, primitive.NewObjectID().Hex())
+
+	later := time.Now().Add(2 * eventSettle)
+	if _, err := scoreEvents(ctx, cfg, primitive.NilObjectID, later); err != nil {
+		t.Fatal(err)
+	}
+	want := cfg.Ranking.BookmarkWeight + cfg.Ranking.ReactionWeight
+	if got := loadScore(t, ctx, snippetID); got.Engagement != want {
+		t.Fatalf("engagement = %v, want %v", got.Engagement, want)
+	}
+
+	// A run that saved this score but failed before moving the checkpoint
+	// is retried from the old checkpoint
+	if _, err := scoreEvents(ctx, cfg, primitive.NilObjectID, later.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadScore(t, ctx, snippetID); got.Engagement != want {
+		t.Errorf("engagement = %v after retrying, want %v", got.Engagement, want)
+	}
+}
+
+func TestSelfEngagementLeavesLeaderboards(t *testing.T) {
+	ctx := useTestDB(t)
+	cfg := rankingConfig()
+	authorID := primitive.NewObjectID()
+	snippetID := insertSnippet(t, ctx, authorID)
+
+	// As backfilled from the snippet by migration 0020
+	_, err := utils.GetCollection("engagement_events").InsertOne(ctx, models.EngagementEvent{
+		ID: primitive.NewObjectID(), SnippetID: snippetID, Kind: models.EngagementBookmark,
+		Actor: authorID.Hex(), CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range []string{models.LeaderboardAuthors, models.LeaderboardSnippets} {
+		board, err := computeLeaderboard(ctx, cfg, kind, models.PeriodAllTime, "", "", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(board.Entries) != 0 {
+			t.Errorf("%s leaderboard ranks self-engagement: %+v", kind, board.Entries)
+		}
+	}
+}
+
+func TestLeaderboardEvictsLeastRecentlyRequested(t *testing.T) {
+	ctx := useTestDB(t)
+	cfg := rankingConfig()
+	cfg.Ranking.Interval = time.Minute
+	insertSnippet(t, ctx, primitive.NewObjectID())
+
+	start := time.Now().Add(-time.Hour)
+	boards := make([]interface{}, 0, maxFilteredLeaderboards)
+	for i := 0; i < maxFilteredLeaderboards; i++ {
+		language := "lang" + primitive.NewObjectID().Hex()
+		boards = append(boards, bson.M{
+			"_id":          leaderboardID(models.LeaderboardAuthors, models.PeriodAllTime, language, ""),
+			"kind":         models.LeaderboardAuthors,
+			"period":       models.PeriodAllTime,
+			"language":     language,
+			"entries":      bson.A{},
+			"computed_at":  start,
+			"requested_at": start.Add(time.Duration(i) * time.Second),
+		})
+	}
+	if _, err := utils.GetCollection("leaderboards").InsertMany(ctx, boards); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Leaderboard(ctx, cfg, models.LeaderboardAuthors, models.PeriodAllTime, "go", ""); err != nil {
+		t.Fatalf("new board refused while the cache is full: %v", err)
+	}
+	collection := utils.GetCollection("leaderboards")
+	count, err := collection.CountDocuments(ctx, filteredLeaderboards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != maxFilteredLeaderboards {
+		t.Errorf("%d filtered boards cached, want %d", count, maxFilteredLeaderboards)
+	}
+	oldest := boards[0].(bson.M)["_id"]
+	if n, _ := collection.CountDocuments(ctx, bson.M{"_id": oldest}); n != 0 {
+		t.Error("least recently requested board was kept")
+	}
+}
@@ -0,0 +1,55 @@
+package feeds
+
+import (
+	"context"
+	"time"
+
+	"snippedia/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// jobState is the shared state of a background job in the "jobs"
+// collection. The lease keeps instances from running the job at the same
+// time; Checkpoint is how far the job got.
+type jobState struct {
+	Name        string             `bson:"_id"`
+	LockedUntil time.Time          `bson:"locked_until"`
+	Checkpoint  primitive.ObjectID `bson:"checkpoint,omitempty"`
+}
+
+// acquireJob takes the job's lease for ttl and returns its state, or nil if
+// another instance holds the lease
+func acquireJob(ctx context.Context, name string, ttl time.Duration) (*jobState, error) {
+	now := time.Now()
+	collection := utils.GetCollection("jobs")
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"_id": name, "locked_until": bson.M{"$lt": now}},
+		bson.M{"$set": bson.M{"locked_until": now.Add(ttl)}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// The job exists and its lease has not run out
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state jobState
+	if err := collection.FindOne(ctx, bson.M{"_id": name}).Decode(&state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// releaseJob saves the job's checkpoint and gives up its lease
+func releaseJob(ctx context.Context, state *jobState) error {
+	_, err := utils.GetCollection("jobs").UpdateByID(ctx, state.Name, bson.M{"$set": bson.M{
+		"locked_until": time.Now(),
+		"checkpoint":   state.Checkpoint,
+	}})
+	return err
+}
@@ -0,0 +1,287 @@
+package feeds
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"snippedia/config"
+	"snippedia/models"
+	"snippedia/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	leaderboardJob = "leaderboards"
+
+	// leaderboardSize is how many entries a leaderboard keeps
+	leaderboardSize = 100
+
+	// leaderboardIdle is how long a filtered leaderboard is kept fresh after
+	// it was last requested
+	leaderboardIdle = 24 * time.Hour
+
+	// maxFilteredLeaderboards bounds how many language and tag leaderboards
+	// are cached and refreshed at once; beyond it the board requested least
+	// recently is dropped
+	maxFilteredLeaderboards = 200
+)
+
+// Leaderboard returns the leaderboard of kind for the period, limited to
+// snippets in language or tagged tag when those are set. Cached boards are
+// served as they are and refreshed in the background; a board is only
+// computed on request the first time or after it fell idle. Filters no
+// public snippet matches get an empty board that is not cached.
+func Leaderboard(ctx context.Context, cfg *config.Config, kind, period, language, tag string) (*models.Leaderboard, error) {
+	language = strings.ToLower(strings.TrimSpace(language))
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	now := time.Now()
+	collection := utils.GetCollection("leaderboards")
+
+	var board models.Leaderboard
+	err := collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": leaderboardID(kind, period, language, tag)},
+		bson.M{"$set": bson.M{"requested_at": now}},
+	).Decode(&board)
+	// Boards nobody asked for lately are no longer refreshed
+	if err == nil && now.Sub(board.ComputedAt) < 2*cfg.Ranking.Interval {
+		return &board, nil
+	}
+	if err == nil {
+		return computeLeaderboard(ctx, cfg, kind, period, language, tag, now)
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	if language != "" || tag != "" {
+		known, err := knownFilter(ctx, language, tag)
+		if err != nil {
+			return nil, err
+		}
+		if !known {
+			return &models.Leaderboard{
+				Kind: kind, Period: period, Language: language, Tag: tag,
+				Entries: []models.LeaderboardEntry{}, ComputedAt: now,
+			}, nil
+		}
+		if err := evictLeaderboards(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return computeLeaderboard(ctx, cfg, kind, period, language, tag, now)
+}
+
+// evictLeaderboards makes room for a new filtered leaderboard by dropping
+// the ones requested least recently, so boards in use are never turned away
+func evictLeaderboards(ctx context.Context) error {
+	collection := utils.GetCollection("leaderboards")
+	cached, err := collection.CountDocuments(ctx, filteredLeaderboards)
+	if err != nil || cached < maxFilteredLeaderboards {
+		return err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "requested_at", Value: 1}}).
+		SetLimit(cached - maxFilteredLeaderboards + 1).
+		SetProjection(bson.M{"_id": 1})
+	cursor, err := collection.Find(ctx, filteredLeaderboards, opts)
+	if err != nil {
+		return err
+	}
+	var oldest []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &oldest); err != nil {
+		return err
+	}
+	ids := make(bson.A, 0, len(oldest))
+	for _, b := range oldest {
+		ids = append(ids, b.ID)
+	}
+	_, err = collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
+
+// filteredLeaderboards matches the cached language and tag leaderboards
+var filteredLeaderboards = bson.M{"$or": bson.A{
+	bson.M{"language": bson.M{"$exists": true}},
+	bson.M{"tag": bson.M{"$exists": true}},
+}}
+
+// knownFilter reports whether any public snippet is in the language and has
+// the tag, using the topic indexes
+func knownFilter(ctx context.Context, language, tag string) (bool, error) {
+	filter := bson.M{"visibility": models.VisibilityPublic}
+	if language != "" {
+		filter["$or"] = bson.A{bson.M{"language": language}, bson.M{"files.language": language}}
+	}
+	if tag != "" {
+		filter["tags"] = tag
+	}
+	count, err := utils.GetCollection("snippets").CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// StartLeaderboards keeps the leaderboards up to date in the background
+func StartLeaderboards(cfg *config.Config) {
+	go func() {
+		ticker := time.NewTicker(cfg.Ranking.Interval)
+		defer ticker.Stop()
+		for {
+			if err := UpdateLeaderboards(context.Background(), cfg); err != nil {
+				log.Println("Failed to update leaderboards:", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// UpdateLeaderboards recomputes the unfiltered leaderboards and every
+// filtered one requested lately. Only one instance runs it at a time; the
+// others return straight away.
+func UpdateLeaderboards(ctx context.Context, cfg *config.Config) error {
+	state, err := acquireJob(ctx, leaderboardJob, cfg.Ranking.Interval)
+	if err != nil || state == nil {
+		return err
+	}
+	defer releaseJob(ctx, state)
+
+	now := time.Now()
+	for _, kind := range []string{models.LeaderboardAuthors, models.LeaderboardSnippets} {
+		for _, period := range []string{models.PeriodWeek, models.PeriodMonth, models.PeriodAllTime} {
+			if _, err := computeLeaderboard(ctx, cfg, kind, period, "", "", now); err != nil {
+				return err
+			}
+		}
+	}
+
+	cursor, err := utils.GetCollection("leaderboards").Find(ctx, bson.M{
+		"requested_at": bson.M{"$gt": now.Add(-leaderboardIdle)},
+		"$or":          filteredLeaderboards["$or"],
+	}, options.Find().SetProjection(bson.M{"entries": 0}).SetLimit(maxFilteredLeaderboards))
+	if err != nil {
+		return err
+	}
+	var boards []models.Leaderboard
+	if err := cursor.All(ctx, &boards); err != nil {
+		return err
+	}
+	for _, b := range boards {
+		if _, err := computeLeaderboard(ctx, cfg, b.Kind, b.Period, b.Language, b.Tag, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// computeLeaderboard aggregates the reactions and bookmarks public snippets
+// received from people other than their authors in the period into a
+// leaderboard and caches it
+func computeLeaderboard(ctx context.Context, cfg *config.Config, kind, period, language, tag string, now time.Time) (*models.Leaderboard, error) {
+	events := bson.M{
+		"kind":       bson.M{"$in": bson.A{models.EngagementReaction, models.EngagementBookmark}},
+		"removed_at": bson.M{"$exists": false},
+	}
+	if since, ok := periodStart(period, now); ok {
+		events["created_at"] = bson.M{"$gte": since}
+	}
+	snippets := bson.M{"snippet.visibility": models.VisibilityPublic}
+	if language != "" {
+		snippets["$or"] = bson.A{
+			bson.M{"snippet.language": language},
+			bson.M{"snippet.files.language": language},
+		}
+	}
+	if tag != "" {
+		snippets["snippet.tags"] = tag
+	}
+	groupBy := "$snippet_id"
+	if kind == models.LeaderboardAuthors {
+		groupBy = "$snippet.author_id"
+	}
+	count := func(k string) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$kind", k}}, 1, 0}}}
+	}
+
+	cursor, err := utils.GetCollection("engagement_events").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: events}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "snippets",
+			"localField":   "snippet_id",
+			"foreignField": "_id",
+			"as":           "snippet",
+		}}},
+		{{Key: "$unwind", Value: "$snippet"}},
+		{{Key: "$match", Value: snippets}},
+		// Authors engaging with their own snippets earn nothing, including
+		// the engagement migration 0020 backfilled
+		{{Key: "$match", Value: bson.M{"$expr": bson.M{"$ne": bson.A{"$actor", bson.M{"$toString": "$snippet.author_id"}}}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       groupBy,
+			"reactions": count(models.EngagementReaction),
+			"bookmarks": count(models.EngagementBookmark),
+		}}},
+		{{Key: "$addFields", Value: bson.M{"score": bson.M{"$add": bson.A{
+			bson.M{"$multiply": bson.A{"$reactions", cfg.Ranking.ReactionWeight}},
+			bson.M{"$multiply": bson.A{"$bookmarks", cfg.Ranking.BookmarkWeight}},
+		}}}}},
+		{{Key: "$match", Value: bson.M{"score": bson.M{"$gt": 0}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$limit", Value: leaderboardSize}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries := []models.LeaderboardEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	board := models.Leaderboard{
+		ID:         leaderboardID(kind, period, language, tag),
+		Kind:       kind,
+		Period:     period,
+		Language:   language,
+		Tag:        tag,
+		Entries:    entries,
+		ComputedAt: now,
+	}
+	// Refreshing a board must not count as a request for it
+	fields := bson.M{"kind": kind, "period": period, "entries": entries, "computed_at": now}
+	if language != "" {
+		fields["language"] = language
+	}
+	if tag != "" {
+		fields["tag"] = tag
+	}
+	_, err = utils.GetCollection("leaderboards").UpdateOne(ctx,
+		bson.M{"_id": board.ID},
+		bson.M{"$set": fields, "$setOnInsert": bson.M{"requested_at": now}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &board, nil
+}
+
+// periodStart is when the period began, or false for all time
+func periodStart(period string, now time.Time) (time.Time, bool) {
+	switch period {
+	case models.PeriodWeek:
+		return now.AddDate(0, 0, -7), true
+	case models.PeriodMonth:
+		return now.AddDate(0, -1, 0), true
+	}
+	return time.Time{}, false
+}
+
+// leaderboardID is the cache key of a leaderboard
+func leaderboardID(kind, period, language, tag string) string {
+	return strings.Join([]string{kind, period, "language=" + language, "tag=" + tag}, ":")
+}
@@ -0,0 +1,325 @@
+package feeds
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"snippedia/config"
+	"snippedia/models"
+	"snippedia/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	rankingJob = "ranking"
+
+	// eventSettle is how old events must be before they are scored, so that
+	// events written late by other instances are not skipped
+	eventSettle = time.Minute
+)
+
+// RecordEngagement notes that actor engaged with a snippet. Repeated
+// engagement of the same kind by the same actor is ignored; engagement the
+// actor withdrew before is restored rather than recorded anew, so it is
+// never scored twice.
+func RecordEngagement(snippetID primitive.ObjectID, kind, actor string) {
+	event := models.EngagementEvent{
+		ID:        primitive.NewObjectID(),
+		SnippetID: snippetID,
+		Kind:      kind,
+		Actor:     actor,
+		CreatedAt: time.Now(),
+	}
+	collection := utils.GetCollection("engagement_events")
+	_, err := collection.InsertOne(context.Background(), event)
+	if mongo.IsDuplicateKeyError(err) {
+		_, err = collection.UpdateOne(context.Background(),
+			bson.M{"snippet_id": snippetID, "kind": kind, "actor": actor, "removed_at": bson.M{"$exists": true}},
+			bson.M{"$unset": bson.M{"removed_at": ""}},
+		)
+	}
+	if err != nil {
+		log.Println("Failed to record engagement:", err)
+	}
+}
+
+// RemoveEngagement marks engagement the actor withdrew, such as a removed
+// bookmark, so leaderboards stop counting it. The event is kept so that
+// engaging again restores it instead of scoring the snippet once more;
+// scores already folded into the rankings are not taken back.
+func RemoveEngagement(snippetID primitive.ObjectID, kind, actor string) {
+	_, err := utils.GetCollection("engagement_events").UpdateOne(context.Background(), bson.M{
+		"snippet_id": snippetID,
+		"kind":       kind,
+		"actor":      actor,
+	}, bson.M{"$set": bson.M{"removed_at": time.Now()}})
+	if err != nil {
+		log.Println("Failed to remove engagement:", err)
+	}
+}
+
+// StartRanking keeps the hot and trending rankings up to date in the
+// background
+func StartRanking(cfg *config.Config) {
+	go func() {
+		ticker := time.NewTicker(cfg.Ranking.Interval)
+		defer ticker.Stop()
+		for {
+			if err := UpdateRankings(context.Background(), cfg); err != nil {
+				log.Println("Failed to update rankings:", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// UpdateRankings scores the engagement recorded since the last run and
+// recomputes the hot and trending rankings. Only one instance runs it at a
+// time; the others return straight away.
+func UpdateRankings(ctx context.Context, cfg *config.Config) error {
+	state, err := acquireJob(ctx, rankingJob, cfg.Ranking.Interval)
+	if err != nil || state == nil {
+		return err
+	}
+	now := time.Now()
+	checkpoint, err := scoreEvents(ctx, cfg, state.Checkpoint, now)
+	if err != nil {
+		// Keep the old checkpoint so the events are scored next time
+		_ = releaseJob(ctx, state)
+		return err
+	}
+	state.Checkpoint = checkpoint
+	if err := releaseJob(ctx, state); err != nil {
+		return err
+	}
+	if err := rankHot(ctx, cfg, now); err != nil {
+		return err
+	}
+	return rankTrending(ctx, cfg, now)
+}
+
+// scoreEvents folds the events after checkpoint into the snippet scores
+// and returns the new checkpoint, which only moves once every score is saved.
+// Each score remembers the last event folded in, so events scored before a
+// failed run are skipped when the run is retried.
+func scoreEvents(ctx context.Context, cfg *config.Config, checkpoint primitive.ObjectID, now time.Time) (primitive.ObjectID, error) {
+	idRange := bson.M{"$lt": primitive.NewObjectIDFromTimestamp(now.Add(-eventSettle))}
+	if !checkpoint.IsZero() {
+		idRange["$gt"] = checkpoint
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	// Engagement withdrawn before it was scored never counts
+	cursor, err := utils.GetCollection("engagement_events").Find(ctx, bson.M{
+		"_id":        idRange,
+		"removed_at": bson.M{"$exists": false},
+	}, opts)
+	if err != nil {
+		return checkpoint, err
+	}
+	events := map[primitive.ObjectID][]models.EngagementEvent{}
+	last := checkpoint
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var event models.EngagementEvent
+		if err := cursor.Decode(&event); err != nil {
+			return checkpoint, err
+		}
+		events[event.SnippetID] = append(events[event.SnippetID], event)
+		last = event.ID
+	}
+	if err := cursor.Err(); err != nil {
+		return checkpoint, err
+	}
+	if len(events) == 0 {
+		return last, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(events))
+	for id := range events {
+		ids = append(ids, id)
+	}
+	scores, err := loadScores(ctx, ids)
+	if err != nil {
+		return checkpoint, err
+	}
+	collection := utils.GetCollection("snippet_scores")
+	for _, id := range ids {
+		score, ok := scores[id]
+		if !ok {
+			// Snippets deleted since are simply not scored
+			continue
+		}
+		var engagement, trending float64
+		scored := false
+		for _, event := range events[id] {
+			// Events are sorted, so those up to the last one folded in were
+			// already scored by a run that failed later on
+			if event.ID.Hex() <= score.LastEventID.Hex() {
+				continue
+			}
+			w := weight(cfg, event.Kind)
+			engagement += w
+			trending += w * decay(cfg, now.Sub(event.CreatedAt))
+			score.LastEventID = event.ID
+			scored = true
+		}
+		if !scored {
+			continue
+		}
+		score.Engagement += engagement
+		score.Trending = score.Trending*decay(cfg, now.Sub(score.TrendingAt)) + trending
+		score.TrendingAt = now
+		_, err := collection.ReplaceOne(ctx, bson.M{"_id": id}, score, options.Replace().SetUpsert(true))
+		if err != nil {
+			return checkpoint, err
+		}
+	}
+	return last, nil
+}
+
+// loadScores returns the current scores of the snippets, starting new ones
+// from zero
+func loadScores(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]models.SnippetScore, error) {
+	cursor, err := utils.GetCollection("snippet_scores").Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var existing []models.SnippetScore
+	if err := cursor.All(ctx, &existing); err != nil {
+		return nil, err
+	}
+	scores := make(map[primitive.ObjectID]models.SnippetScore, len(ids))
+	for _, s := range existing {
+		scores[s.SnippetID] = s
+	}
+
+	var missing []primitive.ObjectID
+	for _, id := range ids {
+		if _, ok := scores[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return scores, nil
+	}
+	opts := options.Find().SetProjection(bson.M{"created_at": 1})
+	cursor, err = utils.GetCollection("snippets").Find(ctx, bson.M{"_id": bson.M{"$in": missing}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var snippets []models.Snippet
+	if err := cursor.All(ctx, &snippets); err != nil {
+		return nil, err
+	}
+	for _, s := range snippets {
+		scores[s.ID] = models.SnippetScore{SnippetID: s.ID, TrendingAt: time.Now(), SnippetCreatedAt: s.CreatedAt}
+	}
+	return scores, nil
+}
+
+// rankHot ranks young snippets by engagement, pulled down by their age
+func rankHot(ctx context.Context, cfg *config.Config, now time.Time) error {
+	cursor, err := utils.GetCollection("snippet_scores").Find(ctx, bson.M{
+		"snippet_created_at": bson.M{"$gt": now.Add(-cfg.Ranking.HotWindow)},
+	})
+	if err != nil {
+		return err
+	}
+	var scores []models.SnippetScore
+	if err := cursor.All(ctx, &scores); err != nil {
+		return err
+	}
+	ranked := make(map[primitive.ObjectID]float64, len(scores))
+	for _, s := range scores {
+		ranked[s.SnippetID] = hotScore(cfg, s.Engagement, now.Sub(s.SnippetCreatedAt))
+	}
+	return saveRanking(ctx, cfg, models.RankingHot, ranked, now)
+}
+
+// rankTrending ranks snippets by their recent, time-decayed engagement
+func rankTrending(ctx context.Context, cfg *config.Config, now time.Time) error {
+	// After ten half-lives a score is down to a thousandth and cannot trend
+	cursor, err := utils.GetCollection("snippet_scores").Find(ctx, bson.M{
+		"trending_at": bson.M{"$gt": now.Add(-10 * cfg.Ranking.TrendingHalfLife)},
+	})
+	if err != nil {
+		return err
+	}
+	var scores []models.SnippetScore
+	if err := cursor.All(ctx, &scores); err != nil {
+		return err
+	}
+	ranked := make(map[primitive.ObjectID]float64, len(scores))
+	for _, s := range scores {
+		ranked[s.SnippetID] = s.Trending * decay(cfg, now.Sub(s.TrendingAt))
+	}
+	return saveRanking(ctx, cfg, models.RankingTrending, ranked, now)
+}
+
+// saveRanking stores the best public snippets of ranked, best first
+func saveRanking(ctx context.Context, cfg *config.Config, name string, ranked map[primitive.ObjectID]float64, now time.Time) error {
+	ids := make([]primitive.ObjectID, 0, len(ranked))
+	for id, score := range ranked {
+		if score > 0 {
+			ids = append(ids, id)
+		}
+	}
+	// Snippets made private since they were engaged with drop out
+	values, err := utils.GetCollection("snippets").Distinct(ctx, "_id", bson.M{
+		"_id":        bson.M{"$in": ids},
+		"visibility": models.VisibilityPublic,
+	})
+	if err != nil {
+		return err
+	}
+	public := make([]primitive.ObjectID, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			public = append(public, id)
+		}
+	}
+	sort.Slice(public, func(i, j int) bool {
+		if ranked[public[i]] != ranked[public[j]] {
+			return ranked[public[i]] > ranked[public[j]]
+		}
+		return public[i].Hex() > public[j].Hex()
+	})
+	if len(public) > cfg.Ranking.Size {
+		public = public[:cfg.Ranking.Size]
+	}
+	ranking := models.Ranking{Name: name, SnippetIDs: public, ComputedAt: now}
+	_, err = utils.GetCollection("rankings").ReplaceOne(ctx, bson.M{"_id": name}, ranking, options.Replace().SetUpsert(true))
+	return err
+}
+
+// weight is how much an engagement of kind counts
+func weight(cfg *config.Config, kind string) float64 {
+	switch kind {
+	case models.EngagementReaction:
+		return cfg.Ranking.ReactionWeight
+	case models.EngagementBookmark:
+		return cfg.Ranking.BookmarkWeight
+	case models.EngagementComment:
+		return cfg.Ranking.CommentWeight
+	case models.EngagementView:
+		return cfg.Ranking.ViewWeight
+	}
+	return 0
+}
+
+// hotScore is engagement pulled down by the snippet's age
+func hotScore(cfg *config.Config, engagement float64, age time.Duration) float64 {
+	return engagement / math.Pow(age.Hours()+2, cfg.Ranking.HotGravity)
+}
+
+// decay is the share of a trending score left after age
+func decay(cfg *config.Config, age time.Duration) float64 {
+	return math.Exp2(-age.Hours() / cfg.Ranking.TrendingHalfLife.Hours())
+}
@@ -0,0 +1,76 @@
+package feeds
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"snippedia/config"
+	"snippedia/models"
+)
+
+func rankingConfig() *config.Config {
+	return &config.Config{Ranking: config.RankingConfig{
+		ReactionWeight:   3,
+		BookmarkWeight:   4,
+		CommentWeight:    2,
+		ViewWeight:       0.1,
+		TrendingHalfLife: 24 * time.Hour,
+		HotGravity:       1.8,
+	}}
+}
+
+func TestWeight(t *testing.T) {
+	cfg := rankingConfig()
+	tests := []struct {
+		kind string
+		want float64
+	}{
+		{models.EngagementReaction, 3},
+		{models.EngagementBookmark, 4},
+		{models.EngagementComment, 2},
+		{models.EngagementView, 0.1},
+		{"unknown", 0},
+	}
+	for _, tt := range tests {
+		if got := weight(cfg, tt.kind); got != tt.want {
+			t.Errorf("weight(%q) = %v, want %v", tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestDecay(t *testing.T) {
+	cfg := rankingConfig()
+	tests := []struct {
+		age  time.Duration
+		want float64
+	}{
+		{0, 1},
+		{24 * time.Hour, 0.5},
+		{48 * time.Hour, 0.25},
+		{12 * time.Hour, 1 / math.Sqrt2},
+	}
+	for _, tt := range tests {
+		if got := decay(cfg, tt.age); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("decay(%v) = %v, want %v", tt.age, got, tt.want)
+		}
+	}
+}
+
+func TestHotScore(t *testing.T) {
+	cfg := rankingConfig()
+	if got, want := hotScore(cfg, 10, 0), 10/math.Pow(2, 1.8); math.Abs(got-want) > 1e-9 {
+		t.Errorf("hotScore of a new snippet = %v, want %v", got, want)
+	}
+	if got := hotScore(cfg, 0, time.Hour); got != 0 {
+		t.Errorf("hotScore without engagement = %v, want 0", got)
+	}
+	young := hotScore(cfg, 10, time.Hour)
+	old := hotScore(cfg, 10, 48*time.Hour)
+	if old >= young {
+		t.Errorf("older snippet scored %v, not below the younger one's %v", old, young)
+	}
+	if more := hotScore(cfg, 20, time.Hour); more <= young {
+		t.Errorf("more engagement scored %v, not above %v", more, young)
+	}
+}
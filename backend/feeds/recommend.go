@@ -0,0 +1,310 @@
+package feeds
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"snippedia/models"
+	"snippedia/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// How much each signal counts towards the similarity of two snippets
+const (
+	tagWeight        = 3.0
+	languageWeight   = 1.0
+	tokenWeight      = 2.0
+	coBookmarkWeight = 4.0
+
+	// topicBoost is added for snippets in a topic the user follows
+	topicBoost = 1.0
+)
+
+const (
+	// candidateLimit bounds how many snippets are scored per recommendation
+	candidateLimit = 300
+
+	// seedLimit bounds how many of a user's bookmarks and reactions shape
+	// their recommendations
+	seedLimit = 50
+
+	// maxTokens bounds how many distinct code tokens are compared per snippet
+	maxTokens = 500
+
+	// maxScanned bounds how many bytes of code are searched for tokens per
+	// snippet, so large snippets cost no more to compare than small ones
+	maxScanned = 16 * 1024
+)
+
+// identifier matches the code tokens compared between snippets: names of at
+// least three characters, which skips most operators and noise
+var identifier = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]{2,}`)
+
+// features are the parts of a snippet recommendations compare
+type features struct {
+	tags         map[string]bool
+	language     string
+	tokens       map[string]bool
+	bookmarkedBy map[primitive.ObjectID]bool
+}
+
+func featuresOf(s *models.Snippet) features {
+	s.Normalize()
+	f := features{
+		tags:         map[string]bool{},
+		language:     strings.ToLower(s.Language),
+		tokens:       map[string]bool{},
+		bookmarkedBy: map[primitive.ObjectID]bool{},
+	}
+	for _, tag := range s.Tags {
+		f.tags[strings.ToLower(tag)] = true
+	}
+	budget := maxScanned
+	for _, file := range s.Files {
+		if budget <= 0 || len(f.tokens) >= maxTokens {
+			break
+		}
+		content := file.Content
+		if len(content) > budget {
+			content = content[:budget]
+		}
+		budget -= len(content)
+		for _, token := range identifier.FindAllString(content, maxTokens) {
+			if len(f.tokens) >= maxTokens {
+				break
+			}
+			f.tokens[strings.ToLower(token)] = true
+		}
+	}
+	for _, id := range s.BookmarkedBy {
+		f.bookmarkedBy[id] = true
+	}
+	return f
+}
+
+// similarity scores how alike two snippets are from shared tags, language,
+// code tokens and the people who bookmarked both
+func similarity(a, b features) float64 {
+	score := tagWeight*jaccard(a.tags, b.tags) + tokenWeight*jaccard(a.tokens, b.tokens)
+	if a.language != "" && a.language == b.language {
+		score += languageWeight
+	}
+	if len(a.bookmarkedBy) > 0 && len(b.bookmarkedBy) > 0 {
+		shared := 0
+		for id := range a.bookmarkedBy {
+			if b.bookmarkedBy[id] {
+				shared++
+			}
+		}
+		score += coBookmarkWeight * float64(shared) / math.Sqrt(float64(len(a.bookmarkedBy)*len(b.bookmarkedBy)))
+	}
+	return score
+}
+
+func jaccard[K comparable](a, b map[K]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for k := range a {
+		if b[k] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// Related returns up to limit public snippets most like the snippet. Besides
+// snippets sharing a tag, the language or a bookmark, the newest public
+// snippets are scored too, so ones sharing only code can still be picked.
+func Related(ctx context.Context, snippet *models.Snippet, limit int) ([]models.Snippet, error) {
+	source := featuresOf(snippet)
+	public := bson.M{
+		"_id":        bson.M{"$ne": snippet.ID},
+		"visibility": models.VisibilityPublic,
+	}
+	candidates, err := findCandidates(ctx, public)
+	if err != nil {
+		return nil, err
+	}
+
+	var or bson.A
+	if len(source.tags) > 0 {
+		or = append(or, bson.M{"tags": bson.M{"$in": keys(source.tags)}})
+	}
+	if source.language != "" {
+		or = append(or, bson.M{"language": source.language})
+	}
+	if len(source.bookmarkedBy) > 0 {
+		or = append(or, bson.M{"bookmarked_by": bson.M{"$in": keys(source.bookmarkedBy)}})
+	}
+	if len(or) > 0 {
+		public["$or"] = or
+		matching, err := findCandidates(ctx, public)
+		if err != nil {
+			return nil, err
+		}
+		candidates = mergeCandidates(candidates, matching)
+	}
+	return best(candidates, limit, func(f features) float64 {
+		return similarity(source, f)
+	}), nil
+}
+
+// ForYou returns up to limit public snippets for the user, like the ones they
+// bookmarked or reacted to and in the topics and languages they follow or
+// prefer. It returns nothing when there is nothing to go on yet.
+func ForYou(ctx context.Context, user *models.User, limit int) ([]models.Snippet, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(seedLimit)
+	cursor, err := utils.GetCollection("snippets").Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"bookmarked_by": user.ID},
+		bson.M{"reactions.user_id": user.ID},
+	}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var seeds []models.Snippet
+	if err := cursor.All(ctx, &seeds); err != nil {
+		return nil, err
+	}
+
+	topics := user.Topics
+	topics.Languages = append(append([]string{}, topics.Languages...), user.Profile.PreferredLanguages...)
+	seedFeatures := make([]features, 0, len(seeds))
+	seen := make(bson.A, 0, len(seeds))
+	tags := map[string]bool{}
+	languages := map[string]bool{}
+	coUsers := map[primitive.ObjectID]bool{}
+	for i := range seeds {
+		f := featuresOf(&seeds[i])
+		seedFeatures = append(seedFeatures, f)
+		seen = append(seen, seeds[i].ID)
+		for tag := range f.tags {
+			tags[tag] = true
+		}
+		if f.language != "" {
+			languages[f.language] = true
+		}
+		for id := range f.bookmarkedBy {
+			if id != user.ID {
+				coUsers[id] = true
+			}
+		}
+	}
+
+	var or bson.A
+	if len(tags) > 0 {
+		or = append(or, bson.M{"tags": bson.M{"$in": keys(tags)}})
+	}
+	if len(languages) > 0 {
+		or = append(or, bson.M{"language": bson.M{"$in": keys(languages)}})
+	}
+	if len(coUsers) > 0 {
+		or = append(or, bson.M{"bookmarked_by": bson.M{"$in": keys(coUsers)}})
+	}
+	if topicFilter := TopicFilter(topics); topicFilter != nil {
+		or = append(or, topicFilter)
+	}
+	if len(or) == 0 {
+		return nil, nil
+	}
+	candidates, err := findCandidates(ctx, bson.M{
+		"_id":        bson.M{"$nin": seen},
+		"author_id":  bson.M{"$ne": user.ID},
+		"visibility": models.VisibilityPublic,
+		"$or":        or,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	followedTags := lowerSet(topics.Tags)
+	followedLanguages := lowerSet(topics.Languages)
+	return best(candidates, limit, func(f features) float64 {
+		score := 0.0
+		for _, seed := range seedFeatures {
+			score = math.Max(score, similarity(seed, f))
+		}
+		if followedLanguages[f.language] {
+			score += topicBoost
+		}
+		for tag := range f.tags {
+			if followedTags[tag] {
+				score += topicBoost
+				break
+			}
+		}
+		return score
+	}), nil
+}
+
+// findCandidates loads the newest snippets matching filter
+func findCandidates(ctx context.Context, filter bson.M) ([]models.Snippet, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(candidateLimit)
+	cursor, err := utils.GetCollection("snippets").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []models.Snippet
+	err = cursor.All(ctx, &candidates)
+	return candidates, err
+}
+
+// mergeCandidates adds the snippets of more that are not in candidates yet
+func mergeCandidates(candidates, more []models.Snippet) []models.Snippet {
+	seen := make(map[primitive.ObjectID]bool, len(candidates))
+	for _, s := range candidates {
+		seen[s.ID] = true
+	}
+	for _, s := range more {
+		if !seen[s.ID] {
+			candidates = append(candidates, s)
+		}
+	}
+	return candidates
+}
+
+// best returns up to limit candidates with a positive score, best first
+func best(candidates []models.Snippet, limit int, score func(features) float64) []models.Snippet {
+	scores := make([]float64, len(candidates))
+	order := make([]int, 0, len(candidates))
+	for i := range candidates {
+		scores[i] = score(featuresOf(&candidates[i]))
+		if scores[i] > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+	if len(order) > limit {
+		order = order[:limit]
+	}
+	result := make([]models.Snippet, 0, len(order))
+	for _, i := range order {
+		result = append(result, candidates[i])
+	}
+	return result
+}
+
+func keys[K comparable](set map[K]bool) bson.A {
+	result := make(bson.A, 0, len(set))
+	for k := range set {
+		result = append(result, k)
+	}
+	return result
+}
+
+func lowerSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[strings.ToLower(name)] = true
+	}
+	return set
+}
@@ -0,0 +1,131 @@
+package feeds
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"snippedia/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func set(names ...string) map[string]bool {
+	s := map[string]bool{}
+	for _, name := range names {
+		s[name] = true
+	}
+	return s
+}
+
+func TestJaccard(t *testing.T) {
+	tests := []struct {
+		a, b map[string]bool
+		want float64
+	}{
+		{set(), set(), 0},
+		{set("go"), set(), 0},
+		{set("go"), set("go"), 1},
+		{set("go", "http"), set("go"), 0.5},
+		{set("go", "http"), set("go", "sql"), 1.0 / 3},
+		{set("go"), set("rust"), 0},
+	}
+	for _, tt := range tests {
+		if got := jaccard(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("jaccard(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	alice, bob := primitive.NewObjectID(), primitive.NewObjectID()
+	tests := []struct {
+		name string
+		a, b features
+		want float64
+	}{
+		{"nothing shared", features{tags: set("go"), language: "go"}, features{tags: set("sql"), language: "sql"}, 0},
+		{"same tags", features{tags: set("http")}, features{tags: set("http")}, tagWeight},
+		{"same language", features{language: "go"}, features{language: "go"}, languageWeight},
+		{"no language", features{}, features{}, 0},
+		{"half the tokens", features{tokens: set("handler", "router")}, features{tokens: set("handler")}, tokenWeight / 2},
+		{
+			"bookmarked by the same people",
+			features{bookmarkedBy: map[primitive.ObjectID]bool{alice: true}},
+			features{bookmarkedBy: map[primitive.ObjectID]bool{alice: true, bob: true}},
+			coBookmarkWeight / math.Sqrt(2),
+		},
+		{
+			"everything",
+			features{tags: set("http"), language: "go", tokens: set("handler")},
+			features{tags: set("http"), language: "go", tokens: set("handler")},
+			tagWeight + languageWeight + tokenWeight,
+		},
+	}
+	for _, tt := range tests {
+		if got := similarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: similarity = %v, want %v", tt.name, got, tt.want)
+		}
+		if got, back := similarity(tt.a, tt.b), similarity(tt.b, tt.a); math.Abs(got-back) > 1e-9 {
+			t.Errorf("%s: similarity is not symmetric: %v and %v", tt.name, got, back)
+		}
+	}
+}
+
+func TestBest(t *testing.T) {
+	candidates := []models.Snippet{
+		{Title: "low", Tags: []string{"1"}},
+		{Title: "none", Tags: []string{"0"}},
+		{Title: "high", Tags: []string{"3"}},
+		{Title: "mid", Tags: []string{"2"}},
+		{Title: "also mid", Tags: []string{"2"}},
+	}
+	// Score each candidate by the number in its tag
+	score := func(f features) float64 {
+		for tag := range f.tags {
+			var n float64
+			fmt.Sscan(tag, &n)
+			return n
+		}
+		return 0
+	}
+	tests := []struct {
+		limit int
+		want  []string
+	}{
+		{10, []string{"high", "mid", "also mid", "low"}},
+		{2, []string{"high", "mid"}},
+		{0, []string{}},
+	}
+	for _, tt := range tests {
+		got := []string{}
+		for _, s := range best(candidates, tt.limit, score) {
+			got = append(got, s.Title)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("best(limit %d) = %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestFeaturesOfBoundsTokens(t *testing.T) {
+	var code strings.Builder
+	for i := 0; code.Len() < 4*maxScanned; i++ {
+		fmt.Fprintf(&code, "name%d ", i)
+	}
+	s := models.Snippet{Files: []models.SnippetFile{{Content: code.String()}, {Content: "unscanned"}}}
+	f := featuresOf(&s)
+	if len(f.tokens) > maxTokens {
+		t.Errorf("%d tokens, want at most %d", len(f.tokens), maxTokens)
+	}
+	if f.tokens["unscanned"] {
+		t.Error("tokens read past the scanning budget")
+	}
+
+	s = models.Snippet{Language: "Go", Tags: []string{"HTTP"}, Files: []models.SnippetFile{{Content: "func ServeHTTP(w, r) {}"}}}
+	f = featuresOf(&s)
+	if !f.tags["http"] || f.language != "go" || !f.tokens["servehttp"] || !f.tokens["func"] || f.tokens["w"] {
+		t.Errorf("features = %+v", f)
+	}
+}
@@ -0,0 +1,29 @@
+// Package feeds builds the snippet feeds that need more than a plain query
+// and runs the background jobs that keep them fresh.
+package feeds
+
+import (
+	"snippedia/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TopicFilter matches snippets with any of the followed tags or languages.
+// Topics, tags and languages are all stored lowercase, so exact matches can
+// use the indexes. It returns nil when no topic is followed.
+func TopicFilter(topics models.FollowedTopics) bson.M {
+	var or bson.A
+	if len(topics.Tags) > 0 {
+		or = append(or, bson.M{"tags": bson.M{"$in": topics.Tags}})
+	}
+	if len(topics.Languages) > 0 {
+		or = append(or,
+			bson.M{"language": bson.M{"$in": topics.Languages}},
+			bson.M{"files.language": bson.M{"$in": topics.Languages}},
+		)
+	}
+	if len(or) == 0 {
+		return nil
+	}
+	return bson.M{"$or": or}
+}
@@ -1,12 +1,22 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"snippedia/auth"
+	"snippedia/badges"
 	"snippedia/config"
+	"snippedia/feeds"
+	"snippedia/migrations"
+	"snippedia/reputation"
 	"snippedia/routes"
 	"snippedia/utils"
+	"snippedia/views"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -22,14 +32,45 @@ func main() {
 
 	// Load configuration
 	cfg := config.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("Refusing to start: ", err)
+	}
 
 	// Connect to MongoDB
 	if err := utils.ConnectDB(cfg.MongoURI, cfg.DatabaseName); err != nil {
 		log.Fatal("Failed to connect to MongoDB:", err)
 	}
 
+	// Bring stored data up to date
+	if err := migrations.Run(utils.DB); err != nil {
+		log.Fatal("Failed to run migrations:", err)
+	}
+
+	// Load the access token signing keys and keep them rotating
+	if err := auth.LoadKeys(context.Background(), cfg); err != nil {
+		log.Fatal("Failed to load signing keys:", err)
+	}
+	auth.StartKeyRotation(cfg)
+
+	// Send digests of followed topics and keep the ranked feeds fresh
+	feeds.StartDigests()
+	feeds.StartRanking(cfg)
+	feeds.StartLeaderboards(cfg)
+
+	// Award badges earned before their rule existed or through missed events
+	badges.StartBackfill()
+	reputation.StartRecompute()
+
+	// Write snippet views in batches
+	views.Start()
+
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
+		// Behind a reverse proxy, take client addresses from its header
+		ProxyHeader:             cfg.ProxyHeader,
+		EnableTrustedProxyCheck: len(cfg.TrustedProxies) > 0,
+		TrustedProxies:          cfg.TrustedProxies,
+		EnableIPValidation:      true,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			if e, ok := err.(*fiber.Error); ok {
@@ -51,14 +92,29 @@ func main() {
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     allowedOrigins,
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-Requested-With",
 		AllowMethods:     "GET, POST, PUT, DELETE",
 		AllowCredentials: true,
 	}))
 
 	// Setup routes
-	routes.SetupRoutes(app)
+	routes.SetupRoutes(app, cfg)
+
+	// Write buffered views before exiting
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+		<-quit
+		if err := app.ShutdownWithTimeout(10 * time.Second); err != nil {
+			log.Println("Failed to shut down cleanly:", err)
+		}
+	}()
 
 	// Start server
-	log.Fatal(app.Listen(":" + cfg.Port))
+	if err := app.Listen(":" + cfg.Port); err != nil {
+		log.Fatal(err)
+	}
+	if err := views.Flush(context.Background()); err != nil {
+		log.Println("Failed to write views:", err)
+	}
 }
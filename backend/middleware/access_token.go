@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"snippedia/models"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// authenticateAccessToken signs the request in with a personal access token.
+// Reads need the read scope and everything else the write scope; routes that
+// need more use RequireScope. The token's scopes are stored in the
+// "token_scopes" local.
+func authenticateAccessToken(c *fiber.Ctx, token string) error {
+	var pat models.PersonalAccessToken
+	err := utils.GetCollection("access_tokens").FindOne(context.Background(), bson.M{
+		"token_hash": utils.HashToken(token),
+		"revoked":    false,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&pat)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired access token")
+	}
+
+	needed := models.ScopeWrite
+	if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+		needed = models.ScopeRead
+	}
+	if !models.ScopesAllow(pat.Scopes, needed) {
+		return fiber.NewError(fiber.StatusForbidden, "Access token lacks the "+needed+" scope")
+	}
+
+	var user models.User
+	err = utils.GetCollection("users").FindOne(context.Background(), bson.M{"_id": pat.UserID}).Decode(&user)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "User not found")
+	}
+
+	_, _ = utils.GetCollection("access_tokens").UpdateByID(context.Background(), pat.ID,
+		bson.M{"$set": bson.M{"last_used_at": time.Now()}})
+
+	c.Locals("user", user)
+	c.Locals("token_scopes", pat.Scopes)
+	return nil
+}
+
+// RequireScope keeps personal access tokens without scope out of a route.
+// Browser sessions are not scoped and always pass. Must run after
+// AuthMiddleware.
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		scopes, ok := c.Locals("token_scopes").([]string)
+		if ok && !models.ScopesAllow(scopes, scope) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Access token lacks the " + scope + " scope",
+			})
+		}
+		return c.Next()
+	}
+}
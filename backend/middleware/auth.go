@@ -3,66 +3,112 @@ package middleware
 import (
 	"context"
 	"strings"
+	"time"
 
+	"snippedia/auth"
 	"snippedia/config"
 	"snippedia/models"
 	"snippedia/utils"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v4"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func AuthMiddleware() fiber.Handler {
+// AuthMiddleware signs requests in with a bearer access token, the session
+// cookie in cookie mode, or a personal access token, and rejects requests
+// that cannot be signed in. The user is stored in the "user" local.
+func AuthMiddleware(cfg *config.Config) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-
-		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Authorization header is required",
-			})
+		if err := authenticate(c, cfg); err != nil {
+			return err
 		}
+		return c.Next()
+	}
+}
 
-		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
+// OptionalAuth signs requests in like AuthMiddleware when they carry valid
+// credentials and lets every other request through anonymously, so public
+// routes can personalize their responses.
+func OptionalAuth(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Stale or broken credentials must not break public pages.
+		// authenticate only sets the user once it has succeeded.
+		_ = authenticate(c, cfg)
+		return c.Next()
+	}
+}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.LoadConfig().JWTSecret), nil
-		})
+// authenticate resolves the request's credentials to a user and stores it in
+// the "user" local. Failures are returned as *fiber.Error.
+func authenticate(c *fiber.Ctx, cfg *config.Config) error {
+	tokenString, ok := bearerToken(c.Get(fiber.HeaderAuthorization))
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, "Authorization header must be \"Bearer <token>\"")
+	}
 
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid token",
-			})
-		}
+	// Fall back to the session cookie in cookie mode
+	fromCookie := false
+	if tokenString == "" {
+		tokenString = c.Cookies(config.SessionCookie)
+		fromCookie = true
+	}
 
-		if !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid token",
-			})
-		}
+	if tokenString == "" {
+		return fiber.NewError(fiber.StatusUnauthorized, "Authorization header is required")
+	}
 
-		claims := token.Claims.(jwt.MapClaims)
-		userID := claims["user_id"].(string)
+	if !fromCookie && strings.HasPrefix(tokenString, models.AccessTokenPrefix) {
+		return authenticateAccessToken(c, tokenString)
+	}
 
-		objectID, err := primitive.ObjectIDFromHex(userID)
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid user ID in token",
-			})
-		}
+	// Cookies ride along on cross-site requests too. Browsers only send
+	// custom headers after a CORS preflight, so requiring one keeps other
+	// sites from making changes on the user's behalf.
+	if fromCookie && c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead && c.Get("X-Requested-With") == "" {
+		return fiber.NewError(fiber.StatusForbidden, "X-Requested-With header is required")
+	}
 
-		// Get user from database
-		var user models.User
-		err = utils.GetCollection("users").FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&user)
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "User not found",
-			})
-		}
+	userID, sessionID, err := auth.ParseAccessToken(cfg, tokenString)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid token")
+	}
 
-		// Set user in context
-		c.Locals("user", user)
-		return c.Next()
+	// Access tokens belong to a session; once it is revoked or expired they
+	// stop working even before they expire themselves
+	count, err := utils.GetCollection("sessions").CountDocuments(context.Background(), bson.M{
+		"_id":        sessionID,
+		"user_id":    userID,
+		"revoked":    false,
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	if err != nil || count == 0 {
+		return fiber.NewError(fiber.StatusUnauthorized, "Session has ended")
+	}
+
+	// Get user from database
+	var user models.User
+	err = utils.GetCollection("users").FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "User not found")
+	}
+
+	// Set user in context
+	c.Locals("user", user)
+	c.Locals("session_id", sessionID)
+	return nil
+}
+
+// bearerToken extracts the token from an Authorization header. An empty
+// header yields an empty token; any other scheme or a missing token is
+// malformed.
+func bearerToken(header string) (string, bool) {
+	if header == "" {
+		return "", true
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	token = strings.TrimSpace(token)
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" || strings.ContainsAny(token, " \t") {
+		return "", false
 	}
+	return token, true
 }
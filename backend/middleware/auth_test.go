@@ -0,0 +1,33 @@
+package middleware
+
+import "testing"
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		token  string
+		ok     bool
+	}{
+		{"no header", "", "", true},
+		{"bearer token", "Bearer abc.def.ghi", "abc.def.ghi", true},
+		// Auth schemes are case-insensitive (RFC 9110, section 11.1)
+		{"lowercase scheme", "bearer abc.def.ghi", "abc.def.ghi", true},
+		{"uppercase scheme", "BEARER abc.def.ghi", "abc.def.ghi", true},
+		{"personal access token", "Bearer snp_abc", "snp_abc", true},
+		{"trailing space", "Bearer abc ", "abc", true},
+		{"Bearer with no token", "Bearer", "", false},
+		{"Bearer with a blank token", "Bearer   ", "", false},
+		{"token without scheme", "abc.def.ghi", "", false},
+		{"basic scheme", "Basic dXNlcjpwYXNz", "", false},
+		{"scheme prefix", "Bearerabc", "", false},
+		{"two tokens", "Bearer abc def", "", false},
+		{"tab in token", "Bearer abc\tdef", "", false},
+	}
+	for _, tt := range tests {
+		token, ok := bearerToken(tt.header)
+		if token != tt.token || ok != tt.ok {
+			t.Errorf("%s: bearerToken(%q) = %q, %v, want %q, %v", tt.name, tt.header, token, ok, tt.token, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+
+	"snippedia/models"
+	"snippedia/policy"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// OrgAccess loads the organization named by the :slug route parameter and
+// only lets callers through that the policy allows to perform action on it.
+// The organization and the caller's role are stored in the "org" and
+// "org_role" locals. Must run after AuthMiddleware.
+func OrgAccess(action policy.Action) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		var org models.Organization
+		err := utils.GetCollection("organizations").FindOne(context.Background(), bson.M{"slug": c.Params("slug")}).Decode(&org)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Organization not found",
+			})
+		}
+
+		subject := policy.Subject{User: &user}
+		if !policy.Can(subject, action, &org) {
+			if !policy.Can(subject, policy.ReadOrg, &org) {
+				// Don't reveal organizations to non-members
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Organization not found",
+				})
+			}
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Your role in this organization does not allow this",
+			})
+		}
+
+		c.Locals("org", org)
+		c.Locals("org_role", org.RoleOf(user.ID))
+		return c.Next()
+	}
+}
@@ -0,0 +1,495 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"snippedia/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is a one-off change to the stored data. Applied migrations are
+// recorded by ID in the "migrations" collection and never run twice.
+type Migration struct {
+	ID string
+	Up func(ctx context.Context, db *mongo.Database) error
+}
+
+// all lists every migration in the order it must be applied
+var all = []Migration{
+	{ID: "0001_snippet_files", Up: snippetFiles},
+	{ID: "0002_snippet_visibility", Up: snippetVisibility},
+	{ID: "0003_organization_indexes", Up: organizationIndexes},
+	{ID: "0004_share_link_indexes", Up: shareLinkIndexes},
+	{ID: "0005_identities", Up: identities},
+	{ID: "0006_auth_code_indexes", Up: authCodeIndexes},
+	{ID: "0007_session_indexes", Up: sessionIndexes},
+	{ID: "0008_access_token_indexes", Up: accessTokenIndexes},
+	{ID: "0009_signing_key_indexes", Up: signingKeyIndexes},
+	{ID: "0010_unique_usernames", Up: uniqueUsernames},
+	{ID: "0011_follow_indexes", Up: followIndexes},
+	{ID: "0012_topic_indexes", Up: topicIndexes},
+	{ID: "0013_ranking_indexes", Up: rankingIndexes},
+	{ID: "0014_badge_awards", Up: badgeAwards},
+	{ID: "0015_moderation_indexes", Up: moderationIndexes},
+	{ID: "0016_leaderboard_indexes", Up: leaderboardIndexes},
+	{ID: "0017_drop_link_requests", Up: dropLinkRequests},
+	{ID: "0018_unset_empty_github_ids", Up: unsetEmptyGitHubIDs},
+	{ID: "0019_lowercase_topics", Up: lowercaseTopics},
+	{ID: "0020_backfill_engagement", Up: backfillEngagement},
+	{ID: "0021_empty_badges", Up: emptyBadges},
+}
+
+// Run applies all pending migrations
+func Run(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	applied := db.Collection("migrations")
+	for _, m := range all {
+		count, err := applied.CountDocuments(ctx, bson.M{"_id": m.ID})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		log.Println("Applying migration", m.ID)
+		if err := m.Up(ctx, db); err != nil {
+			return err
+		}
+		if _, err := applied.InsertOne(ctx, bson.M{"_id": m.ID, "applied_at": time.Now()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snippetFiles moves the code of single-file snippets into the files array
+func snippetFiles(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("snippets").UpdateMany(ctx,
+		bson.M{"files": bson.M{"$exists": false}, "code": bson.M{"$exists": true}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"files": bson.A{bson.M{
+				"filename": models.LegacyFilename,
+				"language": "$language",
+				"content":  "$code",
+			}}}}},
+			{{Key: "$unset", Value: "code"}},
+		},
+	)
+	return err
+}
+
+// snippetVisibility makes every snippet stored before visibility existed public
+func snippetVisibility(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("snippets").UpdateMany(ctx,
+		bson.M{"visibility": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"visibility": models.VisibilityPublic}},
+	)
+	return err
+}
+
+// organizationIndexes keeps organization slugs unique and makes membership
+// and invitation lookups cheap
+func organizationIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("organizations").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "slug", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "members.user_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("org_invitations").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "invitee_id", Value: 1}, {Key: "status", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("snippets").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "org_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	return err
+}
+
+// shareLinkIndexes makes share link tokens unique and fast to resolve
+func shareLinkIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("share_links").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "snippet_id", Value: 1}}},
+	})
+	return err
+}
+
+// identities moves the provider account a user signed up with out of the
+// user document into the identities collection
+func identities(ctx context.Context, db *mongo.Database) error {
+	collection := db.Collection("identities")
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "provider_user_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("link_requests").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	users := db.Collection("users")
+	cursor, err := users.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"github_id": bson.M{"$gt": 0}},
+		bson.M{"provider": bson.M{"$exists": true}},
+	}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var u struct {
+			ID             interface{} `bson:"_id"`
+			GitHubID       int         `bson:"github_id"`
+			Provider       string      `bson:"provider"`
+			ProviderUserID string      `bson:"provider_user_id"`
+			Username       string      `bson:"username"`
+			Email          string      `bson:"email"`
+			CreatedAt      time.Time   `bson:"created_at"`
+		}
+		if err := cursor.Decode(&u); err != nil {
+			return err
+		}
+		provider, providerUserID := u.Provider, u.ProviderUserID
+		if provider == "" {
+			provider, providerUserID = "github", strconv.Itoa(u.GitHubID)
+		}
+		_, err := collection.InsertOne(ctx, bson.M{
+			"user_id":          u.ID,
+			"provider":         provider,
+			"provider_user_id": providerUserID,
+			"username":         u.Username,
+			"email":            u.Email,
+			"created_at":       u.CreatedAt,
+			"last_used_at":     u.CreatedAt,
+		})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	_, err = users.UpdateMany(ctx, bson.M{"provider": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"provider": "", "provider_user_id": ""}})
+	return err
+}
+
+// authCodeIndexes looks one-time login codes up by hash and expires them
+func authCodeIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("auth_codes").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "code_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// sessionIndexes looks sessions up by current and previous refresh token and
+// drops them once they expire
+func sessionIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("sessions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "refresh_token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "previous_token_hash", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// accessTokenIndexes looks personal access tokens up by hash and by owner
+func accessTokenIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("access_tokens").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	return err
+}
+
+// signingKeyIndexes lets only one key exist per generation and drops keys
+// once every token they signed has expired
+func signingKeyIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("signing_keys").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "generation", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// uniqueUsernames renames all but the oldest of users sharing a username,
+// which happened when people with the same name signed in through different
+// providers, then makes usernames unique
+func uniqueUsernames(ctx context.Context, db *mongo.Database) error {
+	users := db.Collection("users")
+	cursor, err := users.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.M{"created_at": 1}}},
+		{{Key: "$group", Value: bson.M{"_id": "$username", "ids": bson.M{"$push": "$_id"}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	})
+	if err != nil {
+		return err
+	}
+	var duplicates []struct {
+		Username string        `bson:"_id"`
+		IDs      []interface{} `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+	for _, d := range duplicates {
+		suffix := 2
+		for _, id := range d.IDs[1:] {
+			for {
+				candidate := d.Username + "-" + strconv.Itoa(suffix)
+				suffix++
+				count, err := users.CountDocuments(ctx, bson.M{"username": candidate})
+				if err != nil {
+					return err
+				}
+				if count > 0 {
+					continue
+				}
+				if _, err := users.UpdateByID(ctx, id, bson.M{"$set": bson.M{"username": candidate}}); err != nil {
+					return err
+				}
+				log.Printf("Renamed duplicate user %s to %s", d.Username, candidate)
+				break
+			}
+		}
+	}
+	_, err = users.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// followIndexes allows one follow per pair of users and serves follower
+// lists and the following feed
+func followIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("follows").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "follower_id", Value: 1}, {Key: "followee_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "followee_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("snippets").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "author_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	return err
+}
+
+// topicIndexes serves the topic feed, digests and notification lists
+func topicIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("snippets").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tags", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "language", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("notifications").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	return err
+}
+
+// rankingIndexes counts each actor once per snippet and kind of engagement
+// and serves the ranking job's queries
+func rankingIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("engagement_events").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "snippet_id", Value: 1}, {Key: "kind", Value: 1}, {Key: "actor", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("snippet_scores").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "snippet_created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "trending_at", Value: 1}}},
+	})
+	return err
+}
+
+// badgeAwards turns badges stored as bare names into awards, dated to when
+// the user joined since the real date is unknown
+func badgeAwards(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("users").UpdateMany(ctx,
+		bson.M{"badges": bson.M{"$type": "string"}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"badges": bson.M{"$map": bson.M{
+			"input": "$badges",
+			"in": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{bson.M{"$type": "$$this"}, "string"}},
+				bson.M{"badge": "$$this", "awarded_at": "$created_at"},
+				"$$this",
+			}},
+		}}}}}},
+	)
+	return err
+}
+
+// moderationIndexes lets reputation count the moderation actions against a
+// user
+func moderationIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("moderation_actions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "action", Value: 1}},
+	})
+	return err
+}
+
+// leaderboardIndexes supports counting engagement by period and drops cached
+// leaderboards nobody has asked for in a week
+func leaderboardIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("engagement_events").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "kind", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("leaderboards").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "requested_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(7 * 24 * 60 * 60),
+	})
+	return err
+}
+
+// dropLinkRequests removes the link tokens identity linking used before it
+// was bound to the browser's state cookie
+func dropLinkRequests(ctx context.Context, db *mongo.Database) error {
+	return db.Collection("link_requests").Drop(ctx)
+}
+
+// unsetEmptyGitHubIDs removes the zero GitHub ID stored on users who signed
+// up with another provider
+func unsetEmptyGitHubIDs(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("users").UpdateMany(ctx,
+		bson.M{"github_id": 0},
+		bson.M{"$unset": bson.M{"github_id": ""}},
+	)
+	return err
+}
+
+// lowercaseTopics lowercases the tags and languages of stored snippets so
+// topic feeds can match them exactly, and indexes file languages, which
+// topic feeds match too
+func lowercaseTopics(ctx context.Context, db *mongo.Database) error {
+	lower := func(field string) bson.M {
+		return bson.M{"$toLower": bson.M{"$trim": bson.M{"input": bson.M{"$ifNull": bson.A{field, ""}}}}}
+	}
+	_, err := db.Collection("snippets").UpdateMany(ctx, bson.M{}, mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"language": lower("$language"),
+		"tags": bson.M{"$map": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$tags", bson.A{}}},
+			"in":    lower("$$this"),
+		}},
+		"files": bson.M{"$map": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$files", bson.A{}}},
+			"in":    bson.M{"$mergeObjects": bson.A{"$$this", bson.M{"language": lower("$$this.language")}}},
+		}},
+	}}}})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("snippets").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "files.language", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	return err
+}
+
+// backfillEngagement records the reactions and bookmarks stored on snippets
+// before engagement events existed, so leaderboards count them. Their real
+// date is unknown; they are dated to when the snippet was created.
+func backfillEngagement(ctx context.Context, db *mongo.Database) error {
+	opts := options.Find().SetProjection(bson.M{"created_at": 1, "reactions": 1, "bookmarked_by": 1})
+	cursor, err := db.Collection("snippets").Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"reactions.0": bson.M{"$exists": true}},
+		bson.M{"bookmarked_by.0": bson.M{"$exists": true}},
+	}}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	events := db.Collection("engagement_events")
+	for cursor.Next(ctx) {
+		var snippet struct {
+			ID           primitive.ObjectID   `bson:"_id"`
+			CreatedAt    time.Time            `bson:"created_at"`
+			Reactions    []models.Reaction    `bson:"reactions"`
+			BookmarkedBy []primitive.ObjectID `bson:"bookmarked_by"`
+		}
+		if err := cursor.Decode(&snippet); err != nil {
+			return err
+		}
+		var docs []interface{}
+		event := func(kind string, actor primitive.ObjectID) models.EngagementEvent {
+			return models.EngagementEvent{
+				ID:        primitive.NewObjectIDFromTimestamp(snippet.CreatedAt),
+				SnippetID: snippet.ID,
+				Kind:      kind,
+				Actor:     actor.Hex(),
+				CreatedAt: snippet.CreatedAt,
+			}
+		}
+		for _, r := range snippet.Reactions {
+			docs = append(docs, event(models.EngagementReaction, r.UserID))
+		}
+		for _, id := range snippet.BookmarkedBy {
+			docs = append(docs, event(models.EngagementBookmark, id))
+		}
+		// Engagement recorded since events exist is already there
+		_, err := events.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		if err != nil && !onlyDuplicateKeys(err) {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// emptyBadges gives users without badges an empty list so awards can be
+// pushed onto it
+func emptyBadges(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("users").UpdateMany(ctx,
+		bson.M{"badges": nil},
+		bson.M{"$set": bson.M{"badges": bson.A{}}},
+	)
+	return err
+}
+
+// onlyDuplicateKeys reports whether every write that failed hit a unique index
+func onlyDuplicateKeys(err error) bool {
+	var bulk mongo.BulkWriteException
+	if !errors.As(err, &bulk) || bulk.WriteConcernError != nil {
+		return false
+	}
+	for _, e := range bulk.WriteErrors {
+		if !mongo.IsDuplicateKeyError(e) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AccessTokenPrefix starts every personal access token, so the auth
+// middleware can tell them from JWTs and leaked tokens are easy to spot
+const AccessTokenPrefix = "snp_"
+
+// Scopes a personal access token can be granted. Each scope includes the
+// ones before it: write can read, admin can do everything.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+var scopeLevels = map[string]int{
+	ScopeRead:  1,
+	ScopeWrite: 2,
+	ScopeAdmin: 3,
+}
+
+// ValidScope reports whether scope is a known token scope
+func ValidScope(scope string) bool {
+	_, ok := scopeLevels[scope]
+	return ok
+}
+
+// ScopesAllow reports whether a token holding scopes may act with scope
+func ScopesAllow(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if scopeLevels[s] >= scopeLevels[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+// PersonalAccessToken lets scripts and editor plugins call the API without
+// a browser login. Only the SHA-256 of the token is stored.
+type PersonalAccessToken struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Name       string             `bson:"name" json:"name"`
+	TokenHash  string             `bson:"token_hash" json:"-"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	ExpiresAt  time.Time          `bson:"expires_at" json:"expires_at"`
+	LastUsedAt *time.Time         `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	Revoked    bool               `bson:"revoked" json:"revoked"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
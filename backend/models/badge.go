@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// AwardedBadge is a badge a user has earned. Badge is the ID of a badge in
+// the catalog.
+type AwardedBadge struct {
+	Badge     string    `bson:"badge" json:"badge"`
+	AwardedAt time.Time `bson:"awarded_at" json:"awarded_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Identity links an account at an external identity provider to a User.
+// A user can sign in with any of their identities.
+type Identity struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Provider       string             `bson:"provider" json:"provider"`
+	ProviderUserID string             `bson:"provider_user_id" json:"provider_user_id"`
+	Username       string             `bson:"username" json:"username"`
+	Email          string             `bson:"email,omitempty" json:"email,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+	LastUsedAt     time.Time          `bson:"last_used_at" json:"last_used_at"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Leaderboard periods
+const (
+	PeriodWeek    = "week"
+	PeriodMonth   = "month"
+	PeriodAllTime = "all"
+)
+
+// What a leaderboard ranks
+const (
+	LeaderboardAuthors  = "authors"
+	LeaderboardSnippets = "snippets"
+)
+
+// ValidPeriod reports whether p is a known leaderboard period
+func ValidPeriod(p string) bool {
+	switch p {
+	case PeriodWeek, PeriodMonth, PeriodAllTime:
+		return true
+	}
+	return false
+}
+
+// Leaderboard is a cached ranking of authors or snippets by the reactions
+// and bookmarks they received in a period, optionally limited to snippets in
+// a language or with a tag. RequestedAt is when it was last served; boards
+// nobody asks for stop being refreshed and eventually expire.
+type Leaderboard struct {
+	ID          string             `bson:"_id" json:"-"`
+	Kind        string             `bson:"kind" json:"kind"`
+	Period      string             `bson:"period" json:"period"`
+	Language    string             `bson:"language,omitempty" json:"language,omitempty"`
+	Tag         string             `bson:"tag,omitempty" json:"tag,omitempty"`
+	Entries     []LeaderboardEntry `bson:"entries" json:"entries"`
+	ComputedAt  time.Time          `bson:"computed_at" json:"computed_at"`
+	RequestedAt time.Time          `bson:"requested_at" json:"-"`
+}
+
+// LeaderboardEntry is an author or snippet and what it received, best first
+type LeaderboardEntry struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	Score     float64            `bson:"score" json:"score"`
+	Reactions int                `bson:"reactions" json:"reactions"`
+	Bookmarks int                `bson:"bookmarks" json:"bookmarks"`
+}
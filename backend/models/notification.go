@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notification types
+const (
+	NotificationTopicDigest = "topic_digest"
+)
+
+// Notification is a message for a user, like a digest of new snippets in
+// the topics they follow
+type Notification struct {
+	ID         primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID   `bson:"user_id" json:"user_id"`
+	Type       string               `bson:"type" json:"type"`
+	SnippetIDs []primitive.ObjectID `bson:"snippet_ids,omitempty" json:"snippet_ids,omitempty"`
+	Count      int                  `bson:"count" json:"count"`
+	Since      time.Time            `bson:"since" json:"since"`
+	Read       bool                 `bson:"read" json:"read"`
+	CreatedAt  time.Time            `bson:"created_at" json:"created_at"`
+}
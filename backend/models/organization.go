@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Organization member roles, from most to least privileged
+const (
+	OrgRoleOwner      = "owner"
+	OrgRoleMaintainer = "maintainer"
+	OrgRoleMember     = "member"
+)
+
+var orgRoleRank = map[string]int{
+	OrgRoleMember:     1,
+	OrgRoleMaintainer: 2,
+	OrgRoleOwner:      3,
+}
+
+// ValidOrgRole reports whether role is a known organization role
+func ValidOrgRole(role string) bool {
+	return orgRoleRank[role] > 0
+}
+
+// OrgRoleAtLeast reports whether role grants at least the rights of min
+func OrgRoleAtLeast(role, min string) bool {
+	return orgRoleRank[role] > 0 && orgRoleRank[role] >= orgRoleRank[min]
+}
+
+// Invitation states
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+	InvitationRevoked  = "revoked"
+)
+
+type OrgMember struct {
+	UserID   primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Role     string             `bson:"role" json:"role"`
+	JoinedAt time.Time          `bson:"joined_at" json:"joined_at"`
+}
+
+type Organization struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Slug        string             `bson:"slug" json:"slug"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description" json:"description"`
+	Members     []OrgMember        `bson:"members" json:"members"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// RoleOf returns the role of the user in the organization, or "" if the user
+// is not a member
+func (o *Organization) RoleOf(userID primitive.ObjectID) string {
+	for _, m := range o.Members {
+		if m.UserID == userID {
+			return m.Role
+		}
+	}
+	return ""
+}
+
+// OwnerCount returns the number of members with the owner role
+func (o *Organization) OwnerCount() int {
+	n := 0
+	for _, m := range o.Members {
+		if m.Role == OrgRoleOwner {
+			n++
+		}
+	}
+	return n
+}
+
+type OrgInvitation struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OrgID     primitive.ObjectID `bson:"org_id" json:"org_id"`
+	InviterID primitive.ObjectID `bson:"inviter_id" json:"inviter_id"`
+	InviteeID primitive.ObjectID `bson:"invitee_id" json:"invitee_id"`
+	Role      string             `bson:"role" json:"role"`
+	Status    string             `bson:"status" json:"status"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"unicode/utf8"
+)
+
+// Limits on user-owned profile fields
+const (
+	MaxBioLength          = 500
+	MaxDisplayNameLength  = 50
+	MaxLocationLength     = 100
+	MaxWebsiteLength      = 200
+	MaxPronounsLength     = 30
+	MaxPreferredLanguages = 10
+	MaxLanguageLength     = 30
+)
+
+// Site themes
+const (
+	ThemeSystem = "system"
+	ThemeLight  = "light"
+	ThemeDark   = "dark"
+)
+
+// Editor keymaps
+const (
+	KeymapDefault = "default"
+	KeymapVim     = "vim"
+	KeymapEmacs   = "emacs"
+)
+
+// UserProfile holds the profile fields only the user edits. Fields synced
+// from the sign-in provider live on User itself.
+type UserProfile struct {
+	DisplayName        string          `bson:"display_name" json:"display_name"`
+	Location           string          `bson:"location" json:"location"`
+	Website            string          `bson:"website" json:"website"`
+	Pronouns           string          `bson:"pronouns" json:"pronouns"`
+	PreferredLanguages []string        `bson:"preferred_languages" json:"preferred_languages"`
+	Preferences        UserPreferences `bson:"preferences" json:"preferences"`
+}
+
+// UserPreferences are the user's display and editor settings. Zero values
+// mean the frontend's defaults.
+type UserPreferences struct {
+	Theme          string `bson:"theme,omitempty" json:"theme,omitempty"`
+	EditorTheme    string `bson:"editor_theme,omitempty" json:"editor_theme,omitempty"`
+	EditorKeymap   string `bson:"editor_keymap,omitempty" json:"editor_keymap,omitempty"`
+	EditorFontSize int    `bson:"editor_font_size,omitempty" json:"editor_font_size,omitempty"`
+	TabSize        int    `bson:"tab_size,omitempty" json:"tab_size,omitempty"`
+}
+
+// Validate checks the profile against the field limits
+func (p *UserProfile) Validate() error {
+	if utf8.RuneCountInString(p.DisplayName) > MaxDisplayNameLength {
+		return fmt.Errorf("display name can be at most %d characters", MaxDisplayNameLength)
+	}
+	if utf8.RuneCountInString(p.Location) > MaxLocationLength {
+		return fmt.Errorf("location can be at most %d characters", MaxLocationLength)
+	}
+	if utf8.RuneCountInString(p.Pronouns) > MaxPronounsLength {
+		return fmt.Errorf("pronouns can be at most %d characters", MaxPronounsLength)
+	}
+	if p.Website != "" {
+		if len(p.Website) > MaxWebsiteLength {
+			return fmt.Errorf("website can be at most %d characters", MaxWebsiteLength)
+		}
+		u, err := url.Parse(p.Website)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("website must be an http or https URL")
+		}
+	}
+	if len(p.PreferredLanguages) > MaxPreferredLanguages {
+		return fmt.Errorf("at most %d preferred languages", MaxPreferredLanguages)
+	}
+	for _, lang := range p.PreferredLanguages {
+		if lang == "" || utf8.RuneCountInString(lang) > MaxLanguageLength {
+			return fmt.Errorf("preferred languages must be 1 to %d characters", MaxLanguageLength)
+		}
+	}
+	return p.Preferences.Validate()
+}
+
+// Validate checks the preferences against the supported values
+func (p *UserPreferences) Validate() error {
+	switch p.Theme {
+	case "", ThemeSystem, ThemeLight, ThemeDark:
+	default:
+		return errors.New("theme must be system, light or dark")
+	}
+	switch p.EditorKeymap {
+	case "", KeymapDefault, KeymapVim, KeymapEmacs:
+	default:
+		return errors.New("editor keymap must be default, vim or emacs")
+	}
+	if len(p.EditorTheme) > MaxLanguageLength {
+		return errors.New("editor theme name is too long")
+	}
+	if p.EditorFontSize != 0 && (p.EditorFontSize < 8 || p.EditorFontSize > 32) {
+		return errors.New("editor font size must be between 8 and 32")
+	}
+	switch p.TabSize {
+	case 0, 2, 4, 8:
+	default:
+		return errors.New("tab size must be 2, 4 or 8")
+	}
+	return nil
+}
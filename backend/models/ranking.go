@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of engagement with a snippet
+const (
+	EngagementReaction = "reaction"
+	EngagementBookmark = "bookmark"
+	EngagementComment  = "comment"
+	EngagementView     = "view"
+)
+
+// Ranked feeds
+const (
+	RankingHot      = "hot"
+	RankingTrending = "trending"
+)
+
+// EngagementEvent records that an actor engaged with a snippet. Each actor
+// counts once per snippet and kind, however often they engage. Actor is a
+// user ID or, for anonymous views, a fingerprint. RemovedAt is set while the
+// actor has withdrawn the engagement, like an undone bookmark.
+type EngagementEvent struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	SnippetID primitive.ObjectID `bson:"snippet_id"`
+	Kind      string             `bson:"kind"`
+	Actor     string             `bson:"actor"`
+	CreatedAt time.Time          `bson:"created_at"`
+	RemovedAt *time.Time         `bson:"removed_at,omitempty"`
+}
+
+// SnippetScore is the running engagement score of a snippet. Engagement is
+// the weighted total; Trending is the weighted total decayed over time, as
+// of TrendingAt. LastEventID is the last event folded in, so that events
+// are never scored twice.
+type SnippetScore struct {
+	SnippetID        primitive.ObjectID `bson:"_id"`
+	Engagement       float64            `bson:"engagement"`
+	Trending         float64            `bson:"trending"`
+	TrendingAt       time.Time          `bson:"trending_at"`
+	SnippetCreatedAt time.Time          `bson:"snippet_created_at"`
+	LastEventID      primitive.ObjectID `bson:"last_event_id,omitempty"`
+}
+
+// Ranking is a precomputed ranked feed, best snippet first
+type Ranking struct {
+	Name       string               `bson:"_id" json:"name"`
+	SnippetIDs []primitive.ObjectID `bson:"snippet_ids" json:"snippet_ids"`
+	ComputedAt time.Time            `bson:"computed_at" json:"computed_at"`
+}
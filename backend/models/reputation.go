@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reputation needed for privileges beyond those of every member
+const (
+	ReputationEditTags = 500
+)
+
+// Moderation actions that cost their target reputation
+const (
+	ModerationSnippetRemoved = "snippet_removed"
+)
+
+// ModerationAction records a moderator acting against a user's content
+type ModerationAction struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	ModeratorID primitive.ObjectID `bson:"moderator_id" json:"moderator_id"`
+	Action      string             `bson:"action" json:"action"`
+	SnippetID   primitive.ObjectID `bson:"snippet_id,omitempty" json:"snippet_id,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
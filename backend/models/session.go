@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuthCode is a one-time code handed to the frontend after login, which it
+// exchanges for the session token. Only the SHA-256 of the code is stored.
+type AuthCode struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	CodeHash  string             `bson:"code_hash"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+}
+
+// Session is a signed-in device. Access tokens carry the session ID and stop
+// working as soon as the session is revoked. The refresh token rotates on
+// every use; only the SHA-256 of the current and previous token is stored.
+type Session struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID            primitive.ObjectID `bson:"user_id" json:"user_id"`
+	RefreshTokenHash  string             `bson:"refresh_token_hash" json:"-"`
+	PreviousTokenHash string             `bson:"previous_token_hash,omitempty" json:"-"`
+	UserAgent         string             `bson:"user_agent" json:"user_agent"`
+	IP                string             `bson:"ip" json:"ip"`
+	CreatedAt         time.Time          `bson:"created_at" json:"created_at"`
+	LastUsedAt        time.Time          `bson:"last_used_at" json:"last_used_at"`
+	ExpiresAt         time.Time          `bson:"expires_at" json:"expires_at"`
+	Revoked           bool               `bson:"revoked" json:"-"`
+}
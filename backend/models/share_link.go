@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ShareLink grants access to a single snippet, whatever its visibility, to
+// anyone holding the token. Only the SHA-256 of the token is stored.
+type ShareLink struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TokenHash string             `bson:"token_hash" json:"-"`
+	SnippetID primitive.ObjectID `bson:"snippet_id" json:"snippet_id"`
+	CreatorID primitive.ObjectID `bson:"creator_id" json:"creator_id"`
+	ExpiresAt *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	MaxViews  int                `bson:"max_views" json:"max_views"` // 0 means unlimited
+	Views     int                `bson:"views" json:"views"`
+	Revoked   bool               `bson:"revoked" json:"revoked"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SigningKey is a key pair access tokens are signed with. Keys are published
+// in the JWKS before they activate and stay there until every token they
+// signed has expired. Each key has a generation one above its predecessor,
+// so instances that rotate at the same time agree on a single new key.
+type SigningKey struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	KeyID      string             `bson:"kid"`
+	Generation int                `bson:"generation"`
+	Algorithm  string             `bson:"alg"`
+	// EncryptedKey is the PKCS #8, PEM encoded private key sealed with
+	// AES-GCM under SIGNING_KEY_SECRET. PrivateKey is the same unencrypted,
+	// as stored before keys were encrypted; it is encrypted on first load.
+	EncryptedKey string     `bson:"encrypted_key,omitempty"`
+	PrivateKey   string     `bson:"private_key,omitempty"`
+	CreatedAt    time.Time  `bson:"created_at"`
+	ActivatesAt  time.Time  `bson:"activates_at"`
+	ExpiresAt    *time.Time `bson:"expires_at,omitempty"` // set once a successor exists
+}
@@ -1,29 +1,87 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Limits applied to the files of a snippet
+const (
+	MaxSnippetFiles    = 20
+	MaxSnippetFileSize = 100 * 1024 // bytes per file
+	MaxFilenameLength  = 255
+	MaxSnippetTags     = 10
+	MaxTagLength       = 35
+)
+
+// Snippet visibility levels
+const (
+	VisibilityPublic   = "public"   // listed and readable by everyone
+	VisibilityUnlisted = "unlisted" // readable by anyone with the link, never listed
+	VisibilityPrivate  = "private"  // readable by the author only
+	VisibilityTeam     = "team"     // readable by members of the owning organization only
+)
+
+// ValidVisibility reports whether v is a known visibility level
+func ValidVisibility(v string) bool {
+	switch v {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate, VisibilityTeam:
+		return true
+	}
+	return false
+}
+
+// Reaction types; each has a counter on the snippet named after it
+const (
+	ReactionUseful     = "useful"
+	ReactionSmart      = "smart"
+	ReactionRefactored = "refactored"
+)
+
+// ValidReactionType reports whether t is a known reaction type
+func ValidReactionType(t string) bool {
+	switch t {
+	case ReactionUseful, ReactionSmart, ReactionRefactored:
+		return true
+	}
+	return false
+}
+
 type Reaction struct {
 	UserID primitive.ObjectID `bson:"user_id" json:"user_id"`
 	Type   string             `bson:"type" json:"type"`
 }
 
+// SnippetFile is a single file of a snippet, like a file in a gist
+type SnippetFile struct {
+	Filename string `bson:"filename" json:"filename"`
+	Language string `bson:"language" json:"language"`
+	Content  string `bson:"content" json:"content"`
+}
+
 type Snippet struct {
-	ID           primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
-	Title        string               `bson:"title" json:"title"`
-	Description  string               `bson:"description" json:"description"`
-	Code         string               `bson:"code" json:"code"`
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Title       string             `bson:"title" json:"title"`
+	Description string             `bson:"description" json:"description"`
+	Files       []SnippetFile      `bson:"files" json:"files"`
+	// Code is the content of legacy single-file snippets. New snippets store
+	// their content in Files; see Normalize.
+	Code         string               `bson:"code,omitempty" json:"code,omitempty"`
 	Language     string               `bson:"language" json:"language"`
 	Tags         []string             `bson:"tags" json:"tags"`
+	Visibility   string               `bson:"visibility" json:"visibility"`
 	AuthorID     primitive.ObjectID   `bson:"author_id" json:"author_id"`
+	OrgID        primitive.ObjectID   `bson:"org_id,omitempty" json:"org_id,omitempty"`
 	CreatedAt    time.Time            `bson:"created_at" json:"created_at"`
 	UpdatedAt    time.Time            `bson:"updated_at" json:"updated_at"`
 	Useful       int                  `bson:"useful" json:"useful"`
 	Smart        int                  `bson:"smart" json:"smart"`
 	Refactored   int                  `bson:"refactored" json:"refactored"`
+	Views        int64                `bson:"views" json:"views"`
 	BookmarkedBy []primitive.ObjectID `bson:"bookmarked_by" json:"bookmarked_by"`
 	Comments     []Comment            `bson:"comments" json:"comments"`
 	Reactions    []Reaction           `bson:"reactions" json:"reactions"`
@@ -40,3 +98,80 @@ type Comment struct {
 	IsReply        bool               `bson:"is_reply" json:"is_reply"`
 	ParentID       primitive.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
 }
+
+// LegacyFilename is the name given to the file of a single-Code snippet
+const LegacyFilename = "snippet"
+
+// Normalize converts a legacy single-Code snippet into the multi-file form,
+// lowercases language names, fills in an unset Language from the first file
+// and defaults the visibility of snippets stored before it existed to
+// public.
+func (s *Snippet) Normalize() {
+	s.Language = strings.ToLower(strings.TrimSpace(s.Language))
+	for i := range s.Files {
+		s.Files[i].Language = strings.ToLower(strings.TrimSpace(s.Files[i].Language))
+	}
+	if len(s.Files) == 0 && s.Code != "" {
+		s.Files = []SnippetFile{{
+			Filename: LegacyFilename,
+			Language: s.Language,
+			Content:  s.Code,
+		}}
+	}
+	s.Code = ""
+	if s.Visibility == "" {
+		s.Visibility = VisibilityPublic
+	}
+	if s.Language == "" && len(s.Files) > 0 {
+		s.Language = s.Files[0].Language
+	}
+}
+
+// ValidateFiles checks the file count, filenames and per-file size limits
+func (s *Snippet) ValidateFiles() error {
+	if len(s.Files) == 0 {
+		return errors.New("a snippet needs at least one file")
+	}
+	if len(s.Files) > MaxSnippetFiles {
+		return fmt.Errorf("a snippet can have at most %d files", MaxSnippetFiles)
+	}
+	seen := make(map[string]bool, len(s.Files))
+	for i, f := range s.Files {
+		if f.Filename == "" {
+			return fmt.Errorf("file %d has no filename", i+1)
+		}
+		if len(f.Filename) > MaxFilenameLength {
+			return fmt.Errorf("filename %q is too long", f.Filename)
+		}
+		if seen[f.Filename] {
+			return fmt.Errorf("duplicate filename %q", f.Filename)
+		}
+		seen[f.Filename] = true
+		if len(f.Content) > MaxSnippetFileSize {
+			return fmt.Errorf("file %q exceeds the %d byte limit", f.Filename, MaxSnippetFileSize)
+		}
+	}
+	return nil
+}
+
+// NormalizeTags lowercases and trims tags and drops empty and duplicate ones,
+// then checks the tag count and length limits
+func NormalizeTags(tags []string) ([]string, error) {
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > MaxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, MaxTagLength)
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	if len(result) > MaxSnippetTags {
+		return nil, fmt.Errorf("a snippet can have at most %d tags", MaxSnippetTags)
+	}
+	return result, nil
+}
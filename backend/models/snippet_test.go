@@ -0,0 +1,114 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Snippet
+		want Snippet
+	}{
+		{
+			"legacy code becomes a file",
+			Snippet{Code: "fmt.Println()", Language: " Go "},
+			Snippet{Files: []SnippetFile{{Filename: LegacyFilename, Language: "go", Content: "fmt.Println()"}}, Language: "go", Visibility: VisibilityPublic},
+		},
+		{
+			"files win over legacy code",
+			Snippet{Code: "old", Files: []SnippetFile{{Filename: "main.go", Language: "Go", Content: "new"}}, Visibility: VisibilityPrivate},
+			Snippet{Files: []SnippetFile{{Filename: "main.go", Language: "go", Content: "new"}}, Language: "go", Visibility: VisibilityPrivate},
+		},
+		{
+			"language kept over the first file's",
+			Snippet{Language: "Python", Files: []SnippetFile{{Filename: "a.go", Language: "go"}}},
+			Snippet{Language: "python", Files: []SnippetFile{{Filename: "a.go", Language: "go"}}, Visibility: VisibilityPublic},
+		},
+		{
+			"nothing to convert",
+			Snippet{},
+			Snippet{Visibility: VisibilityPublic},
+		},
+	}
+	for _, tt := range tests {
+		got := tt.in
+		got.Normalize()
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Normalize = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateFiles(t *testing.T) {
+	files := func(n int) []SnippetFile {
+		result := make([]SnippetFile, n)
+		for i := range result {
+			result[i] = SnippetFile{Filename: fmt.Sprintf("file%d.go", i), Content: "package main"}
+		}
+		return result
+	}
+	file := func(name string, size int) []SnippetFile {
+		return []SnippetFile{{Filename: name, Content: strings.Repeat("x", size)}}
+	}
+	tests := []struct {
+		name    string
+		files   []SnippetFile
+		wantErr bool
+	}{
+		{"no files", nil, true},
+		{"one file", files(1), false},
+		{"20 files", files(MaxSnippetFiles), false},
+		{"21 files", files(MaxSnippetFiles + 1), true},
+		{"100 KB file", file("big.go", MaxSnippetFileSize), false},
+		{"file over 100 KB", file("big.go", MaxSnippetFileSize+1), true},
+		{"255-character name", file(strings.Repeat("n", MaxFilenameLength), 1), false},
+		{"256-character name", file(strings.Repeat("n", MaxFilenameLength+1), 1), true},
+		{"no name", file("", 1), true},
+		{"duplicate names", append(files(2), files(1)...), true},
+	}
+	for _, tt := range tests {
+		s := Snippet{Files: tt.files}
+		if err := s.ValidateFiles(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateFiles = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tags := func(n int) []string {
+		result := make([]string, n)
+		for i := range result {
+			result[i] = fmt.Sprintf("tag%d", i)
+		}
+		return result
+	}
+	tests := []struct {
+		name    string
+		in      []string
+		want    []string
+		wantErr bool
+	}{
+		{"cleaned up", []string{" Go ", "go", "", "HTTP"}, []string{"go", "http"}, false},
+		{"none", nil, []string{}, false},
+		{"10 tags", tags(MaxSnippetTags), tags(MaxSnippetTags), false},
+		{"11 tags", tags(MaxSnippetTags + 1), nil, true},
+		{"duplicates do not count", append(tags(MaxSnippetTags), "TAG0", " tag1"), tags(MaxSnippetTags), false},
+		{"35 characters", []string{strings.Repeat("t", MaxTagLength)}, []string{strings.Repeat("t", MaxTagLength)}, false},
+		{"36 characters", []string{strings.Repeat("t", MaxTagLength+1)}, nil, true},
+		{"trimmed to 35 characters", []string{"  " + strings.Repeat("t", MaxTagLength) + "  "}, []string{strings.Repeat("t", MaxTagLength)}, false},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeTags(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: NormalizeTags error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: NormalizeTags = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
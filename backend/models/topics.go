@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// Digest frequencies for followed topics. Digests are off by default.
+const (
+	DigestOff    = ""
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// Limits on followed topics: how many tags and how many languages a user
+// can follow, and how long a topic name can be
+const (
+	MaxFollowedTopics = 50
+	MaxTopicLength    = 50
+)
+
+// ValidDigestFrequency reports whether frequency is a known digest frequency
+func ValidDigestFrequency(frequency string) bool {
+	return frequency == DigestOff || frequency == DigestDaily || frequency == DigestWeekly
+}
+
+// DigestPeriod is how often digests of the frequency are sent
+func DigestPeriod(frequency string) time.Duration {
+	if frequency == DigestWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// FollowedTopics are the tags and languages a user follows. Names are
+// stored lowercase.
+type FollowedTopics struct {
+	Tags            []string   `bson:"tags" json:"tags"`
+	Languages       []string   `bson:"languages" json:"languages"`
+	DigestFrequency string     `bson:"digest_frequency" json:"digest_frequency"`
+	LastDigestAt    *time.Time `bson:"last_digest_at,omitempty" json:"last_digest_at,omitempty"`
+}
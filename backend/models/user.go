@@ -6,16 +6,49 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Site-wide roles. Users without a role are regular users.
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleUser      = "user"
+)
+
+// Profile fields that are synced from the sign-in provider until the user
+// edits them
+const (
+	FieldBio = "bio"
+)
+
+// User is an account. GitHubID, Username, Email, AvatarURL, Bio and
+// GitHubURL are synced from the sign-in provider; Bio only until the user
+// edits it, GitHubID and GitHubURL only for GitHub identities. Profile is
+// owned by the user and never synced.
 type User struct {
 	ID            primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
-	GitHubID      int                  `bson:"github_id" json:"github_id"`
+	GitHubID      int                  `bson:"github_id,omitempty" json:"github_id,omitempty"`
 	Username      string               `bson:"username" json:"username"`
 	Email         string               `bson:"email" json:"email"`
 	AvatarURL     string               `bson:"avatar_url" json:"avatar_url"`
 	Bio           string               `bson:"bio" json:"bio"`
 	GitHubURL     string               `bson:"github_url" json:"github_url"`
+	Profile       UserProfile          `bson:"profile" json:"profile"`
+	Topics        FollowedTopics       `bson:"topics" json:"-"`
+	Role          string               `bson:"role,omitempty" json:"role,omitempty"`
 	CreatedAt     time.Time            `bson:"created_at" json:"created_at"`
 	UpdatedAt     time.Time            `bson:"updated_at" json:"updated_at"`
-	Badges        []string             `bson:"badges" json:"badges"`
+	Badges        []AwardedBadge       `bson:"badges" json:"badges"`
 	BookmarkedIDs []primitive.ObjectID `bson:"bookmarked_ids" json:"bookmarked_ids"`
+	Reputation    int                  `bson:"reputation" json:"reputation"`
+	LastLoginAt   *time.Time           `bson:"last_login_at,omitempty" json:"last_login_at,omitempty"`
+	EditedFields  []string             `bson:"edited_fields,omitempty" json:"-"` // synced fields the user has overridden
+}
+
+// HasEdited reports whether the user has overridden the synced field
+func (u *User) HasEdited(field string) bool {
+	for _, f := range u.EditedFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
 }
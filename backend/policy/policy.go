@@ -0,0 +1,200 @@
+// Package policy decides what a user may do with a resource. It never
+// touches the database: everything a decision needs is carried by the
+// Subject and the resource, which keeps every rule testable in isolation.
+package policy
+
+import (
+	"snippedia/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Action string
+
+// Snippet actions
+const (
+	ReadSnippet     Action = "snippet:read"
+	UpdateSnippet   Action = "snippet:update"
+	DeleteSnippet   Action = "snippet:delete"
+	ReactSnippet    Action = "snippet:react"
+	BookmarkSnippet Action = "snippet:bookmark"
+	CommentSnippet  Action = "snippet:comment"
+	ShareSnippet    Action = "snippet:share"
+	EditTags        Action = "snippet:edit_tags"
+)
+
+// Comment actions, checked against a CommentTarget
+const (
+	UpdateComment Action = "comment:update"
+	DeleteComment Action = "comment:delete"
+)
+
+// Organization actions, checked against a *models.Organization
+const (
+	ReadOrg           Action = "org:read"
+	UpdateOrg         Action = "org:update"
+	CreateOrgSnippet  Action = "org:create_snippet"
+	ManageInvitations Action = "org:manage_invitations"
+)
+
+// Membership actions, checked against an OrgMembership
+const (
+	InviteMember     Action = "membership:invite"
+	ChangeMemberRole Action = "membership:change_role"
+	RemoveMember     Action = "membership:remove"
+)
+
+// Subject is the user a decision is made for. A nil User is an anonymous
+// visitor. OrgRoles maps the IDs of the user's organizations to the user's
+// role in each; it is only consulted for team snippets.
+type Subject struct {
+	User     *models.User
+	OrgRoles map[primitive.ObjectID]string
+}
+
+// Anonymous is the subject of unauthenticated requests
+var Anonymous = Subject{}
+
+// CommentTarget is a comment together with the snippet it belongs to
+type CommentTarget struct {
+	Snippet *models.Snippet
+	Comment *models.Comment
+}
+
+// OrgMembership is a (prospective) member of an organization. Role is the
+// role being granted for InviteMember and ChangeMemberRole, and the member's
+// current role for RemoveMember.
+type OrgMembership struct {
+	Org    *models.Organization
+	UserID primitive.ObjectID
+	Role   string
+}
+
+// Can reports whether subject may perform action on resource
+func Can(subject Subject, action Action, resource interface{}) bool {
+	if subject.isAdmin() {
+		return true
+	}
+	switch r := resource.(type) {
+	case *models.Snippet:
+		return canSnippet(subject, action, r)
+	case CommentTarget:
+		return canComment(subject, action, r)
+	case *models.Organization:
+		return canOrg(subject, action, r)
+	case OrgMembership:
+		return canMembership(subject, action, r)
+	}
+	return false
+}
+
+// ActsAsModerator reports whether subject may perform action on resource
+// only because of their site role, which makes doing it a moderation action
+func ActsAsModerator(subject Subject, action Action, resource interface{}) bool {
+	if subject.User == nil || !Can(subject, action, resource) {
+		return false
+	}
+	member := *subject.User
+	member.Role = models.RoleUser
+	return !Can(Subject{User: &member, OrgRoles: subject.OrgRoles}, action, resource)
+}
+
+func canSnippet(s Subject, action Action, snippet *models.Snippet) bool {
+	readable := s.canRead(snippet)
+	switch action {
+	case ReadSnippet:
+		return readable
+	case ReactSnippet, BookmarkSnippet, CommentSnippet:
+		return s.User != nil && readable
+	case UpdateSnippet, ShareSnippet:
+		return s.owns(snippet.AuthorID)
+	case EditTags:
+		// Trusted members help keep tags tidy on everyone's snippets
+		return s.owns(snippet.AuthorID) || s.isModerator() ||
+			(s.User != nil && readable && snippet.Visibility == models.VisibilityPublic &&
+				s.User.Reputation >= models.ReputationEditTags)
+	case DeleteSnippet:
+		if s.owns(snippet.AuthorID) || s.isModerator() {
+			return true
+		}
+		// Organization maintainers curate their shared library
+		return !snippet.OrgID.IsZero() && models.OrgRoleAtLeast(s.OrgRoles[snippet.OrgID], models.OrgRoleMaintainer)
+	}
+	return false
+}
+
+func (s Subject) canRead(snippet *models.Snippet) bool {
+	switch snippet.Visibility {
+	case models.VisibilityPublic, models.VisibilityUnlisted, "":
+		return true
+	case models.VisibilityPrivate:
+		return s.owns(snippet.AuthorID) || s.isModerator()
+	case models.VisibilityTeam:
+		if s.owns(snippet.AuthorID) || s.isModerator() {
+			return true
+		}
+		return !snippet.OrgID.IsZero() && s.OrgRoles[snippet.OrgID] != ""
+	}
+	return false
+}
+
+func canComment(s Subject, action Action, t CommentTarget) bool {
+	if t.Snippet == nil || t.Comment == nil || !s.canRead(t.Snippet) {
+		return false
+	}
+	switch action {
+	case UpdateComment:
+		return s.owns(t.Comment.AuthorID)
+	case DeleteComment:
+		// Authors can clean up discussions on their own snippets
+		return s.owns(t.Comment.AuthorID) || s.owns(t.Snippet.AuthorID) || s.isModerator()
+	}
+	return false
+}
+
+func canOrg(s Subject, action Action, org *models.Organization) bool {
+	if s.User == nil {
+		return false
+	}
+	role := org.RoleOf(s.User.ID)
+	switch action {
+	case ReadOrg, CreateOrgSnippet:
+		return role != ""
+	case UpdateOrg, ManageInvitations:
+		return models.OrgRoleAtLeast(role, models.OrgRoleMaintainer)
+	}
+	return false
+}
+
+func canMembership(s Subject, action Action, m OrgMembership) bool {
+	if s.User == nil || m.Org == nil {
+		return false
+	}
+	role := m.Org.RoleOf(s.User.ID)
+	switch action {
+	case InviteMember:
+		// Nobody can hand out more rights than they hold
+		return models.OrgRoleAtLeast(role, models.OrgRoleMaintainer) && models.OrgRoleAtLeast(role, m.Role)
+	case ChangeMemberRole:
+		return role == models.OrgRoleOwner
+	case RemoveMember:
+		if m.UserID == s.User.ID {
+			return role != ""
+		}
+		return role == models.OrgRoleOwner ||
+			(role == models.OrgRoleMaintainer && m.Role == models.OrgRoleMember)
+	}
+	return false
+}
+
+func (s Subject) owns(authorID primitive.ObjectID) bool {
+	return s.User != nil && !authorID.IsZero() && s.User.ID == authorID
+}
+
+func (s Subject) isAdmin() bool {
+	return s.User != nil && s.User.Role == models.RoleAdmin
+}
+
+func (s Subject) isModerator() bool {
+	return s.User != nil && (s.User.Role == models.RoleModerator || s.User.Role == models.RoleAdmin)
+}
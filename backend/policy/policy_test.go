@@ -0,0 +1,281 @@
+package policy
+
+import (
+	"testing"
+
+	"snippedia/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fixture is an organization with an owner, a maintainer and a member, an
+// author in it, and users outside of it
+type fixture struct {
+	org                                         *models.Organization
+	author, owner, maintainer, member, outsider Subject
+	stranger, moderator, admin                  Subject
+}
+
+func newFixture() fixture {
+	user := func(role string) *models.User {
+		return &models.User{ID: primitive.NewObjectID(), Role: role}
+	}
+	org := &models.Organization{ID: primitive.NewObjectID()}
+	otherOrg := primitive.NewObjectID()
+	inOrg := func(u *models.User, role string) Subject {
+		org.Members = append(org.Members, models.OrgMember{UserID: u.ID, Role: role})
+		return Subject{User: u, OrgRoles: map[primitive.ObjectID]string{org.ID: role}}
+	}
+	f := fixture{org: org}
+	f.author = inOrg(user(""), models.OrgRoleMember)
+	f.owner = inOrg(user(""), models.OrgRoleOwner)
+	f.maintainer = inOrg(user(""), models.OrgRoleMaintainer)
+	f.member = inOrg(user(""), models.OrgRoleMember)
+	f.outsider = Subject{User: user(""), OrgRoles: map[primitive.ObjectID]string{otherOrg: models.OrgRoleOwner}}
+	f.stranger = Subject{User: user(models.RoleUser)}
+	f.moderator = Subject{User: user(models.RoleModerator)}
+	f.admin = Subject{User: user(models.RoleAdmin)}
+	return f
+}
+
+func (f fixture) snippet(visibility string) *models.Snippet {
+	return &models.Snippet{
+		ID:         primitive.NewObjectID(),
+		AuthorID:   f.author.User.ID,
+		OrgID:      f.org.ID,
+		Visibility: visibility,
+	}
+}
+
+func TestCanReadSnippet(t *testing.T) {
+	f := newFixture()
+	visibilities := []string{
+		models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate, models.VisibilityTeam,
+	}
+	tests := []struct {
+		name    string
+		subject Subject
+		want    [4]bool // by visibility, in the order above
+	}{
+		{"anonymous", Anonymous, [4]bool{true, true, false, false}},
+		{"stranger", f.stranger, [4]bool{true, true, false, false}},
+		{"member of another org", f.outsider, [4]bool{true, true, false, false}},
+		{"org member", f.member, [4]bool{true, true, false, true}},
+		{"org maintainer", f.maintainer, [4]bool{true, true, false, true}},
+		{"org owner", f.owner, [4]bool{true, true, false, true}},
+		{"author", f.author, [4]bool{true, true, true, true}},
+		{"moderator", f.moderator, [4]bool{true, true, true, true}},
+		{"admin", f.admin, [4]bool{true, true, true, true}},
+	}
+	for _, tt := range tests {
+		for i, v := range visibilities {
+			if got := Can(tt.subject, ReadSnippet, f.snippet(v)); got != tt.want[i] {
+				t.Errorf("%s reading a %s snippet: got %v, want %v", tt.name, v, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestCanReadTeamSnippetWithoutOrg(t *testing.T) {
+	f := newFixture()
+	snippet := f.snippet(models.VisibilityTeam)
+	snippet.OrgID = primitive.NilObjectID
+	// A zero org ID must not match subjects whose role map has one
+	subject := Subject{User: f.stranger.User, OrgRoles: map[primitive.ObjectID]string{primitive.NilObjectID: models.OrgRoleOwner}}
+	if Can(subject, ReadSnippet, snippet) {
+		t.Error("team snippet without an organization is readable by a non-author")
+	}
+}
+
+func TestCanModifySnippet(t *testing.T) {
+	f := newFixture()
+	reputable := Subject{User: &models.User{ID: primitive.NewObjectID(), Reputation: models.ReputationEditTags}}
+	tests := []struct {
+		name       string
+		subject    Subject
+		visibility string
+		action     Action
+		want       bool
+	}{
+		{"anonymous reacts", Anonymous, models.VisibilityPublic, ReactSnippet, false},
+		{"anonymous bookmarks", Anonymous, models.VisibilityPublic, BookmarkSnippet, false},
+		{"anonymous comments", Anonymous, models.VisibilityPublic, CommentSnippet, false},
+		{"stranger reacts to public", f.stranger, models.VisibilityPublic, ReactSnippet, true},
+		{"stranger comments on unlisted", f.stranger, models.VisibilityUnlisted, CommentSnippet, true},
+		{"stranger bookmarks private", f.stranger, models.VisibilityPrivate, BookmarkSnippet, false},
+		{"outsider reacts to team", f.outsider, models.VisibilityTeam, ReactSnippet, false},
+		{"member comments on team", f.member, models.VisibilityTeam, CommentSnippet, true},
+
+		{"author updates", f.author, models.VisibilityPrivate, UpdateSnippet, true},
+		{"author shares", f.author, models.VisibilityPublic, ShareSnippet, true},
+		{"author deletes", f.author, models.VisibilityPrivate, DeleteSnippet, true},
+		{"stranger updates", f.stranger, models.VisibilityPublic, UpdateSnippet, false},
+		{"stranger deletes", f.stranger, models.VisibilityPublic, DeleteSnippet, false},
+		{"org owner updates", f.owner, models.VisibilityTeam, UpdateSnippet, false},
+		{"moderator updates", f.moderator, models.VisibilityPublic, UpdateSnippet, false},
+		{"moderator deletes", f.moderator, models.VisibilityPrivate, DeleteSnippet, true},
+		{"admin updates", f.admin, models.VisibilityPrivate, UpdateSnippet, true},
+
+		{"org member deletes team", f.member, models.VisibilityTeam, DeleteSnippet, false},
+		{"org maintainer deletes team", f.maintainer, models.VisibilityTeam, DeleteSnippet, true},
+		{"org owner deletes team", f.owner, models.VisibilityTeam, DeleteSnippet, true},
+		{"outsider owner deletes team", f.outsider, models.VisibilityTeam, DeleteSnippet, false},
+
+		{"stranger edits tags", f.stranger, models.VisibilityPublic, EditTags, false},
+		{"reputable user edits public tags", reputable, models.VisibilityPublic, EditTags, true},
+		{"reputable user edits unlisted tags", reputable, models.VisibilityUnlisted, EditTags, false},
+		{"reputable user edits private tags", reputable, models.VisibilityPrivate, EditTags, false},
+		{"moderator edits private tags", f.moderator, models.VisibilityPrivate, EditTags, true},
+		{"author edits tags", f.author, models.VisibilityTeam, EditTags, true},
+
+		{"unknown action", f.author, models.VisibilityPublic, Action("snippet:unknown"), false},
+	}
+	for _, tt := range tests {
+		if got := Can(tt.subject, tt.action, f.snippet(tt.visibility)); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCanComment(t *testing.T) {
+	f := newFixture()
+	commenter := Subject{User: &models.User{ID: primitive.NewObjectID()}}
+	target := func(visibility string) CommentTarget {
+		return CommentTarget{
+			Snippet: f.snippet(visibility),
+			Comment: &models.Comment{ID: primitive.NewObjectID(), AuthorID: commenter.User.ID},
+		}
+	}
+	tests := []struct {
+		name       string
+		subject    Subject
+		visibility string
+		action     Action
+		want       bool
+	}{
+		{"commenter updates", commenter, models.VisibilityPublic, UpdateComment, true},
+		{"commenter deletes", commenter, models.VisibilityPublic, DeleteComment, true},
+		{"commenter deletes on a snippet turned private", commenter, models.VisibilityPrivate, DeleteComment, false},
+		{"snippet author updates", f.author, models.VisibilityPublic, UpdateComment, false},
+		{"snippet author deletes", f.author, models.VisibilityPublic, DeleteComment, true},
+		{"stranger deletes", f.stranger, models.VisibilityPublic, DeleteComment, false},
+		{"moderator deletes", f.moderator, models.VisibilityPublic, DeleteComment, true},
+		{"moderator updates", f.moderator, models.VisibilityPublic, UpdateComment, false},
+		{"anonymous deletes", Anonymous, models.VisibilityPublic, DeleteComment, false},
+	}
+	for _, tt := range tests {
+		if got := Can(tt.subject, tt.action, target(tt.visibility)); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if Can(f.author, DeleteComment, CommentTarget{}) {
+		t.Error("empty comment target is allowed")
+	}
+}
+
+func TestCanOrg(t *testing.T) {
+	f := newFixture()
+	tests := []struct {
+		name    string
+		subject Subject
+		action  Action
+		want    bool
+	}{
+		{"anonymous reads", Anonymous, ReadOrg, false},
+		{"stranger reads", f.stranger, ReadOrg, false},
+		{"outsider reads", f.outsider, ReadOrg, false},
+		{"member reads", f.member, ReadOrg, true},
+		{"member creates snippet", f.member, CreateOrgSnippet, true},
+		{"member updates", f.member, UpdateOrg, false},
+		{"member manages invitations", f.member, ManageInvitations, false},
+		{"maintainer updates", f.maintainer, UpdateOrg, true},
+		{"maintainer manages invitations", f.maintainer, ManageInvitations, true},
+		{"owner updates", f.owner, UpdateOrg, true},
+		{"moderator reads", f.moderator, ReadOrg, false},
+		{"admin updates", f.admin, UpdateOrg, true},
+	}
+	for _, tt := range tests {
+		if got := Can(tt.subject, tt.action, f.org); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCanMembership(t *testing.T) {
+	f := newFixture()
+	membership := func(subject Subject, role string) OrgMembership {
+		return OrgMembership{Org: f.org, UserID: subject.User.ID, Role: role}
+	}
+	newcomer := OrgMembership{Org: f.org, UserID: primitive.NewObjectID(), Role: models.OrgRoleMember}
+	tests := []struct {
+		name     string
+		subject  Subject
+		action   Action
+		resource OrgMembership
+		want     bool
+	}{
+		{"member invites", f.member, InviteMember, newcomer, false},
+		{"maintainer invites member", f.maintainer, InviteMember, newcomer, true},
+		{"maintainer invites owner", f.maintainer, InviteMember,
+			OrgMembership{Org: f.org, UserID: primitive.NewObjectID(), Role: models.OrgRoleOwner}, false},
+		{"owner invites owner", f.owner, InviteMember,
+			OrgMembership{Org: f.org, UserID: primitive.NewObjectID(), Role: models.OrgRoleOwner}, true},
+		{"outsider invites", f.outsider, InviteMember, newcomer, false},
+
+		{"maintainer changes role", f.maintainer, ChangeMemberRole, membership(f.member, models.OrgRoleMaintainer), false},
+		{"owner changes role", f.owner, ChangeMemberRole, membership(f.member, models.OrgRoleMaintainer), true},
+
+		{"member leaves", f.member, RemoveMember, membership(f.member, models.OrgRoleMember), true},
+		{"member removes member", f.member, RemoveMember, membership(f.author, models.OrgRoleMember), false},
+		{"maintainer removes member", f.maintainer, RemoveMember, membership(f.member, models.OrgRoleMember), true},
+		{"maintainer removes owner", f.maintainer, RemoveMember, membership(f.owner, models.OrgRoleOwner), false},
+		{"owner removes maintainer", f.owner, RemoveMember, membership(f.maintainer, models.OrgRoleMaintainer), true},
+		{"stranger leaves", f.stranger, RemoveMember, membership(f.stranger, ""), false},
+		{"anonymous removes", Anonymous, RemoveMember, membership(f.member, models.OrgRoleMember), false},
+		{"admin removes owner", f.admin, RemoveMember, membership(f.owner, models.OrgRoleOwner), true},
+	}
+	for _, tt := range tests {
+		if got := Can(tt.subject, tt.action, tt.resource); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if Can(f.owner, InviteMember, OrgMembership{UserID: primitive.NewObjectID()}) {
+		t.Error("membership without an organization is allowed")
+	}
+}
+
+func TestCanUnknownResource(t *testing.T) {
+	f := newFixture()
+	if Can(f.author, ReadSnippet, "not a resource") {
+		t.Error("unknown resource is allowed")
+	}
+}
+
+func TestActsAsModerator(t *testing.T) {
+	f := newFixture()
+	tests := []struct {
+		name       string
+		subject    Subject
+		visibility string
+		want       bool
+	}{
+		{"moderator deletes someone else's snippet", f.moderator, models.VisibilityPublic, true},
+		{"admin deletes someone else's snippet", f.admin, models.VisibilityPrivate, true},
+		{"author deletes own snippet", f.author, models.VisibilityPublic, false},
+		{"maintainer deletes team snippet", f.maintainer, models.VisibilityTeam, false},
+		{"stranger cannot delete", f.stranger, models.VisibilityPublic, false},
+		{"anonymous cannot delete", Anonymous, models.VisibilityPublic, false},
+	}
+	for _, tt := range tests {
+		if got := ActsAsModerator(tt.subject, DeleteSnippet, f.snippet(tt.visibility)); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// A moderator deleting their own snippet is not moderating
+	own := f.snippet(models.VisibilityPublic)
+	own.AuthorID = f.moderator.User.ID
+	if ActsAsModerator(f.moderator, DeleteSnippet, own) {
+		t.Error("moderator deleting their own snippet acts as moderator")
+	}
+}
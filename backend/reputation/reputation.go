@@ -0,0 +1,163 @@
+// Package reputation scores how much the community trusts a user. The score
+// is always derived from stored data, so it can be recomputed at any time.
+package reputation
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"snippedia/models"
+	"snippedia/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Points per signal
+const (
+	usefulPoints     = 10
+	smartPoints      = 10
+	refactoredPoints = 5
+	bookmarkPoints   = 5
+	removalPenalty   = 50
+)
+
+// recomputeInterval is how often every user's reputation is recomputed
+const recomputeInterval = 24 * time.Hour
+
+// Privilege is something users can do once their reputation is high enough
+type Privilege struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Reputation  int    `json:"reputation"`
+}
+
+// Privileges lists what reputation unlocks
+var Privileges = []Privilege{
+	{ID: "edit_tags", Description: "Edit the tags of other people's public snippets", Reputation: models.ReputationEditTags},
+}
+
+// Compute derives the user's reputation from the reactions and bookmarks
+// other people gave their snippets, less penalties for content moderators
+// removed. Reacting to or bookmarking one's own snippets earns nothing. It
+// never goes below zero.
+func Compute(ctx context.Context, userID primitive.ObjectID) (int, error) {
+	fromOthers := func(field, cond string) bson.M {
+		return bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{field, bson.A{}}},
+			"cond":  bson.M{"$ne": bson.A{cond, userID}},
+		}}
+	}
+	reactions := func(kind string) bson.M {
+		return bson.M{"$sum": bson.M{"$size": bson.M{"$filter": bson.M{
+			"input": "$reactions",
+			"cond":  bson.M{"$eq": bson.A{"$$this.type", kind}},
+		}}}}
+	}
+	cursor, err := utils.GetCollection("snippets").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"author_id": userID}}},
+		{{Key: "$project", Value: bson.M{
+			"reactions": fromOthers("$reactions", "$$this.user_id"),
+			"bookmarks": bson.M{"$size": fromOthers("$bookmarked_by", "$$this")},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        nil,
+			"useful":     reactions("useful"),
+			"smart":      reactions("smart"),
+			"refactored": reactions("refactored"),
+			"bookmarks":  bson.M{"$sum": "$bookmarks"},
+		}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var totals []signals
+	if err := cursor.All(ctx, &totals); err != nil {
+		return 0, err
+	}
+	var received signals
+	if len(totals) > 0 {
+		received = totals[0]
+	}
+
+	removals, err := utils.GetCollection("moderation_actions").CountDocuments(ctx, bson.M{
+		"user_id": userID,
+		"action":  models.ModerationSnippetRemoved,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return score(received, int(removals)), nil
+}
+
+// signals counts what others gave a user's snippets
+type signals struct {
+	Useful     int `bson:"useful"`
+	Smart      int `bson:"smart"`
+	Refactored int `bson:"refactored"`
+	Bookmarks  int `bson:"bookmarks"`
+}
+
+// score weighs the signals, less the penalty for each removal, never going
+// below zero
+func score(s signals, removals int) int {
+	points := s.Useful*usefulPoints + s.Smart*smartPoints + s.Refactored*refactoredPoints + s.Bookmarks*bookmarkPoints
+	points -= removals * removalPenalty
+	if points < 0 {
+		return 0
+	}
+	return points
+}
+
+// Recompute stores the user's current reputation
+func Recompute(ctx context.Context, userID primitive.ObjectID) error {
+	score, err := Compute(ctx, userID)
+	if err != nil {
+		return err
+	}
+	_, err = utils.GetCollection("users").UpdateByID(ctx, userID, bson.M{"$set": bson.M{"reputation": score}})
+	return err
+}
+
+// Notify recomputes the user's reputation in the background after something
+// that affects it happened
+func Notify(userID primitive.ObjectID) {
+	go func() {
+		if err := Recompute(context.Background(), userID); err != nil {
+			log.Println("Failed to recompute reputation:", err)
+		}
+	}()
+}
+
+// StartRecompute recomputes every user's reputation now and then daily, so
+// changes to the formula and missed events catch up
+func StartRecompute() {
+	go func() {
+		ticker := time.NewTicker(recomputeInterval)
+		defer ticker.Stop()
+		for {
+			if err := RecomputeAll(context.Background()); err != nil {
+				log.Println("Failed to recompute reputations:", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// RecomputeAll recomputes every user's reputation, skipping users that fail
+func RecomputeAll(ctx context.Context) error {
+	values, err := utils.GetCollection("users").Distinct(ctx, "_id", bson.M{})
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			if err := Recompute(ctx, id); err != nil {
+				log.Printf("Failed to recompute reputation of user %s: %v", id.Hex(), err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package reputation
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"snippedia/migrations"
+	"snippedia/models"
+	"snippedia/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		signals  signals
+		removals int
+		want     int
+	}{
+		{"nothing", signals{}, 0, 0},
+		{"useful", signals{Useful: 1}, 0, 10},
+		{"smart", signals{Smart: 1}, 0, 10},
+		{"refactored", signals{Refactored: 1}, 0, 5},
+		{"bookmark", signals{Bookmarks: 1}, 0, 5},
+		{"everything", signals{Useful: 2, Smart: 3, Refactored: 4, Bookmarks: 5}, 0, 20 + 30 + 20 + 25},
+		{"removal penalty", signals{Useful: 10}, 1, 50},
+		{"floor at zero", signals{Useful: 1}, 1, 0},
+		{"removals only", signals{}, 3, 0},
+	}
+	for _, tt := range tests {
+		if got := score(tt.signals, tt.removals); got != tt.want {
+			t.Errorf("%s: score = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestComputeFromHistory(t *testing.T) {
+	uri := os.Getenv("SNIPPEDIA_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("SNIPPEDIA_TEST_MONGO_URI is not set")
+	}
+	ctx := context.Background()
+	if err := utils.ConnectDB(uri, "snippedia_test_"+primitive.NewObjectID().Hex()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		utils.DB.Drop(context.Background())
+		utils.DB.Client().Disconnect(context.Background())
+	})
+	if err := migrations.Run(utils.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	authorID, readerID, otherID := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	snippets := []interface{}{
+		models.Snippet{
+			ID: primitive.NewObjectID(), AuthorID: authorID, Visibility: models.VisibilityPublic, CreatedAt: time.Now(),
+			Reactions: []models.Reaction{
+				{UserID: authorID, Type: models.ReactionUseful}, // their own, earns nothing
+				{UserID: readerID, Type: models.ReactionUseful},
+				{UserID: otherID, Type: models.ReactionRefactored},
+			},
+			BookmarkedBy: []primitive.ObjectID{authorID, readerID},
+		},
+		models.Snippet{
+			ID: primitive.NewObjectID(), AuthorID: authorID, Visibility: models.VisibilityPrivate, CreatedAt: time.Now(),
+			Reactions: []models.Reaction{{UserID: readerID, Type: models.ReactionSmart}},
+		},
+		// Someone else's snippet the author engaged with
+		models.Snippet{
+			ID: primitive.NewObjectID(), AuthorID: readerID, Visibility: models.VisibilityPublic, CreatedAt: time.Now(),
+			Reactions:    []models.Reaction{{UserID: authorID, Type: models.ReactionUseful}},
+			BookmarkedBy: []primitive.ObjectID{authorID},
+		},
+	}
+	if _, err := utils.GetCollection("snippets").InsertMany(ctx, snippets); err != nil {
+		t.Fatal(err)
+	}
+	want := usefulPoints + refactoredPoints + bookmarkPoints + smartPoints
+	if got, err := Compute(ctx, authorID); err != nil || got != want {
+		t.Fatalf("Compute = %d, %v; want %d", got, err, want)
+	}
+
+	_, err := utils.GetCollection("moderation_actions").InsertOne(ctx, models.ModerationAction{
+		UserID: authorID, ModeratorID: otherID, Action: models.ModerationSnippetRemoved, CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Compute(ctx, authorID); err != nil || got != 0 {
+		t.Errorf("Compute after a removal = %d, %v; want 0", got, err)
+	}
+}
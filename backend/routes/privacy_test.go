@@ -0,0 +1,389 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"snippedia/auth"
+	"snippedia/config"
+	"snippedia/migrations"
+	"snippedia/models"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testMongoEnv names the MongoDB the privacy tests run against. Each run
+// uses a fresh database on it and drops it afterwards.
+const testMongoEnv = "SNIPPEDIA_TEST_MONGO_URI"
+
+// Who looks at the snippets. The author owns every snippet that must not
+// leak and belongs to the organization they are in.
+const (
+	anonymous = "anonymous"
+	stranger  = "another user"
+	member    = "org member"
+	author    = "author"
+)
+
+var secretVisibilities = []string{models.VisibilityPrivate, models.VisibilityTeam, models.VisibilityUnlisted}
+
+type privacyFixture struct {
+	app    *fiber.App
+	tokens map[string]string
+	users  map[string]models.User
+	org    models.Organization
+	public models.Snippet
+	// secret are the author's private, team and unlisted snippets, all in
+	// the organization, all tagged and written like the public snippet,
+	// and all bookmarked, reacted to and ranked
+	secret map[string]models.Snippet
+}
+
+func newPrivacyFixture(t *testing.T) *privacyFixture {
+	t.Helper()
+	uri := os.Getenv(testMongoEnv)
+	if uri == "" {
+		t.Skip(testMongoEnv + " is not set")
+	}
+	t.Setenv("PUBLIC_URL", "http://api.test")
+	t.Setenv("STATE_SECRET", "privacy-test-state-secret-0123456789")
+	t.Setenv("SIGNING_KEY_SECRET", "privacy-test-signing-key-secret-0123456789")
+	cfg := config.LoadConfig()
+
+	ctx := context.Background()
+	if err := utils.ConnectDB(uri, "snippedia_test_"+primitive.NewObjectID().Hex()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		utils.DB.Drop(context.Background())
+		utils.DB.Client().Disconnect(context.Background())
+	})
+	if err := migrations.Run(utils.DB); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.LoadKeys(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &privacyFixture{
+		tokens: map[string]string{},
+		users:  map[string]models.User{},
+		secret: map[string]models.Snippet{},
+	}
+	now := time.Now()
+	for i, name := range []string{stranger, member, author, "publisher"} {
+		user := models.User{
+			ID:        primitive.NewObjectID(),
+			Username:  "privacy-user-" + string(rune('a'+i)),
+			Badges:    []models.AwardedBadge{},
+			Topics:    models.FollowedTopics{Tags: []string{"privacy"}, Languages: []string{"go"}},
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		f.users[name] = user
+	}
+	f.org = models.Organization{
+		ID:   primitive.NewObjectID(),
+		Slug: "privacy-org",
+		Name: "Privacy Org",
+		Members: []models.OrgMember{
+			{UserID: f.users[author].ID, Role: models.OrgRoleOwner, JoinedAt: now},
+			{UserID: f.users[member].ID, Role: models.OrgRoleMember, JoinedAt: now},
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	readers := []primitive.ObjectID{f.users[stranger].ID, f.users[member].ID}
+	snippet := func(title, visibility string, authorID primitive.ObjectID) models.Snippet {
+		s := models.Snippet{
+			ID:           primitive.NewObjectID(),
+			Title:        title,
+			Description:  "a secret snippet",
+			Files:        []models.SnippetFile{{Filename: "main.go", Language: "go", Content: "package main"}},
+			Language:     "go",
+			Tags:         []string{"privacy", "secret"},
+			Visibility:   visibility,
+			AuthorID:     authorID,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+			Useful:       len(readers),
+			BookmarkedBy: readers,
+			Comments:     []models.Comment{},
+		}
+		for _, id := range readers {
+			s.Reactions = append(s.Reactions, models.Reaction{UserID: id, Type: "useful"})
+		}
+		return s
+	}
+	f.public = snippet("public privacy snippet", models.VisibilityPublic, f.users["publisher"].ID)
+	f.public.Description = "a public snippet"
+
+	var docs, events []interface{}
+	ranked := []primitive.ObjectID{f.public.ID}
+	bookmarked := []primitive.ObjectID{}
+	for _, visibility := range secretVisibilities {
+		s := snippet("secret "+visibility+" snippet", visibility, f.users[author].ID)
+		s.OrgID = f.org.ID
+		f.secret[visibility] = s
+		docs = append(docs, s)
+		ranked = append(ranked, s.ID)
+		bookmarked = append(bookmarked, s.ID)
+	}
+	docs = append(docs, f.public)
+	for _, id := range ranked {
+		for _, reader := range readers {
+			for _, kind := range []string{models.EngagementReaction, models.EngagementBookmark} {
+				events = append(events, models.EngagementEvent{
+					SnippetID: id, Kind: kind, Actor: reader.Hex(), CreatedAt: now,
+				})
+			}
+		}
+	}
+
+	insert := func(collection string, docs ...interface{}) {
+		if _, err := utils.GetCollection(collection).InsertMany(ctx, docs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{stranger, member} {
+		user := f.users[name]
+		user.BookmarkedIDs = bookmarked
+		f.users[name] = user
+	}
+	for _, user := range f.users {
+		insert("users", user)
+	}
+	insert("organizations", f.org)
+	insert("snippets", docs...)
+	insert("engagement_events", events...)
+	// Rankings computed before the snippets stopped being public
+	insert("rankings",
+		models.Ranking{Name: models.RankingHot, SnippetIDs: ranked, ComputedAt: now},
+		models.Ranking{Name: models.RankingTrending, SnippetIDs: ranked, ComputedAt: now},
+	)
+	for _, reader := range readers {
+		insert("follows", models.Follow{FollowerID: reader, FolloweeID: f.users[author].ID, CreatedAt: now})
+	}
+
+	for _, name := range []string{stranger, member, author} {
+		session := models.Session{
+			ID:         primitive.NewObjectID(),
+			UserID:     f.users[name].ID,
+			CreatedAt:  now,
+			LastUsedAt: now,
+			ExpiresAt:  now.Add(time.Hour),
+		}
+		insert("sessions", session)
+		token, err := auth.IssueAccessToken(cfg, session.UserID, session.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.tokens[name] = token
+	}
+
+	f.app = fiber.New()
+	SetupRoutes(f.app, cfg)
+	return f
+}
+
+func (f *privacyFixture) get(t *testing.T, viewer, path string) (int, []byte) {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	if token := f.tokens[viewer]; token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	resp, err := f.app.Test(req, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+// assertHidden fails if the body mentions a secret snippet the viewer may
+// not see there, by ID or by title
+func (f *privacyFixture) assertHidden(t *testing.T, body []byte, allowed []string) {
+	t.Helper()
+	for _, visibility := range secretVisibilities {
+		if contains(allowed, visibility) {
+			continue
+		}
+		s := f.secret[visibility]
+		if bytes.Contains(body, []byte(s.ID.Hex())) || bytes.Contains(body, []byte(s.Title)) {
+			t.Errorf("%s snippet leaked: %s", visibility, body)
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSecretSnippetsStayOutOfListings(t *testing.T) {
+	f := newPrivacyFixture(t)
+	orgSnippets := "/api/orgs/" + f.org.Slug + "/snippets"
+	tests := []struct {
+		name string
+		path string
+		// status by viewer when not 200
+		status map[string]int
+		// secret visibilities each viewer may find in the response
+		allowed map[string][]string
+	}{
+		{name: "all snippets", path: "/api/snippets"},
+		{name: "hot feed", path: "/api/feed/hot"},
+		{name: "trending feed", path: "/api/feed/trending"},
+		{name: "related snippets", path: "/api/snippets/" + f.public.ID.Hex() + "/related"},
+		{name: "snippet leaderboard", path: "/api/leaderboards/snippets?period=all"},
+		{name: "tag leaderboard", path: "/api/leaderboards/snippets?period=all&tag=secret"},
+		{name: "language leaderboard", path: "/api/leaderboards/snippets?period=week&language=go"},
+		{name: "author profile", path: "/api/users/" + f.users[author].Username},
+		{
+			name:   "own snippets",
+			path:   "/api/user/snippets",
+			status: map[string]int{anonymous: fiber.StatusUnauthorized},
+		},
+		{
+			name:   "bookmarks",
+			path:   "/api/user/bookmarks",
+			status: map[string]int{anonymous: fiber.StatusUnauthorized},
+			// Bookmarks list what the viewer can still open
+			allowed: map[string][]string{
+				stranger: {models.VisibilityUnlisted},
+				member:   {models.VisibilityUnlisted, models.VisibilityTeam},
+			},
+		},
+		{
+			name:   "followed topics feed",
+			path:   "/api/feed/topics",
+			status: map[string]int{anonymous: fiber.StatusUnauthorized},
+		},
+		{
+			name:   "following feed",
+			path:   "/api/feed/following",
+			status: map[string]int{anonymous: fiber.StatusUnauthorized},
+		},
+		{
+			name:   "for you feed",
+			path:   "/api/feed/for-you",
+			status: map[string]int{anonymous: fiber.StatusUnauthorized},
+		},
+		{
+			name:    "org snippets",
+			path:    orgSnippets,
+			status:  map[string]int{anonymous: fiber.StatusUnauthorized, stranger: fiber.StatusNotFound},
+			allowed: map[string][]string{member: {models.VisibilityUnlisted, models.VisibilityTeam}},
+		},
+		{
+			name:    "org snippet search",
+			path:    orgSnippets + "?q=secret",
+			status:  map[string]int{anonymous: fiber.StatusUnauthorized, stranger: fiber.StatusNotFound},
+			allowed: map[string][]string{member: {models.VisibilityUnlisted, models.VisibilityTeam}},
+		},
+	}
+	for _, tt := range tests {
+		for _, viewer := range []string{anonymous, stranger, member} {
+			t.Run(tt.name+"/"+viewer, func(t *testing.T) {
+				status, body := f.get(t, viewer, tt.path)
+				want := fiber.StatusOK
+				if s, ok := tt.status[viewer]; ok {
+					want = s
+				}
+				if status != want {
+					t.Fatalf("status = %d, want %d: %s", status, want, body)
+				}
+				f.assertHidden(t, body, tt.allowed[viewer])
+			})
+		}
+	}
+}
+
+func TestAuthorLeaderboardIgnoresSecretSnippets(t *testing.T) {
+	f := newPrivacyFixture(t)
+	for _, viewer := range []string{anonymous, stranger, member} {
+		status, body := f.get(t, viewer, "/api/leaderboards/authors?period=all")
+		if status != fiber.StatusOK {
+			t.Fatalf("%s: status = %d: %s", viewer, status, body)
+		}
+		if bytes.Contains(body, []byte(f.users[author].ID.Hex())) {
+			t.Errorf("%s: author ranked for engagement with secret snippets: %s", viewer, body)
+		}
+		if !bytes.Contains(body, []byte(f.users["publisher"].ID.Hex())) {
+			t.Errorf("%s: publisher of the public snippet missing: %s", viewer, body)
+		}
+	}
+}
+
+func TestProfileCountsOnlyPublicSnippets(t *testing.T) {
+	f := newPrivacyFixture(t)
+	for _, viewer := range []string{anonymous, stranger, member} {
+		status, body := f.get(t, viewer, "/api/users/"+f.users[author].Username)
+		if status != fiber.StatusOK {
+			t.Fatalf("%s: status = %d: %s", viewer, status, body)
+		}
+		var profile struct {
+			Reactions map[string]int `json:"reactions_received"`
+			Snippets  struct {
+				Total int `json:"total"`
+			} `json:"snippets"`
+		}
+		if err := json.Unmarshal(body, &profile); err != nil {
+			t.Fatal(err)
+		}
+		if profile.Snippets.Total != 0 {
+			t.Errorf("%s: profile counts %d snippets, want 0", viewer, profile.Snippets.Total)
+		}
+		for kind, n := range profile.Reactions {
+			if n != 0 {
+				t.Errorf("%s: profile counts %d %s reactions on secret snippets", viewer, n, kind)
+			}
+		}
+	}
+}
+
+func TestSecretSnippetsCannotBeOpened(t *testing.T) {
+	f := newPrivacyFixture(t)
+	// Unlisted snippets open for anyone with the link and team snippets for
+	// the organization; everything else is reported as not found
+	readable := map[string][]string{
+		anonymous: {models.VisibilityUnlisted},
+		stranger:  {models.VisibilityUnlisted},
+		member:    {models.VisibilityUnlisted, models.VisibilityTeam},
+		author:    secretVisibilities,
+	}
+	for _, viewer := range []string{anonymous, stranger, member, author} {
+		for _, visibility := range secretVisibilities {
+			id := f.secret[visibility].ID.Hex()
+			want := fiber.StatusNotFound
+			if contains(readable[viewer], visibility) {
+				want = fiber.StatusOK
+			}
+			for _, path := range []string{"/api/snippets/" + id, "/api/snippets/" + id + "/related"} {
+				status, body := f.get(t, viewer, path)
+				if status != want {
+					t.Errorf("%s opening %s: status = %d, want %d: %s", viewer, path, status, want, body)
+				}
+				if want == fiber.StatusNotFound && bytes.Contains(body, []byte(f.secret[visibility].Title)) {
+					t.Errorf("%s opening %s: body leaks the snippet: %s", viewer, path, body)
+				}
+			}
+		}
+	}
+}
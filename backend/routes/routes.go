@@ -1,29 +1,95 @@
 package routes
 
 import (
+	"snippedia/config"
 	"snippedia/controllers"
 	"snippedia/middleware"
+	"snippedia/models"
+	"snippedia/policy"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func SetupRoutes(app *fiber.App) {
+func SetupRoutes(app *fiber.App, cfg *config.Config) {
+	// Public keys for verifying access tokens
+	app.Get("/.well-known/jwks.json", controllers.GetJWKS)
+
 	// Auth routes
-	app.Get("/auth/github/callback", controllers.GitHubCallback)
+	app.Get("/auth/providers", controllers.GetOAuthProviders(cfg))
+	app.Get("/auth/:provider/login", controllers.OAuthLogin(cfg))
+	app.Get("/auth/:provider/callback", controllers.OAuthCallback(cfg))
+	app.Post("/auth/token", controllers.ExchangeAuthCode(cfg))
+	app.Post("/auth/refresh", controllers.RefreshSession(cfg))
+	app.Post("/auth/logout", controllers.Logout(cfg))
+
+	// Public snippet routes, personalized when the caller is signed in
+	app.Get("/api/snippets", middleware.OptionalAuth(cfg), controllers.GetSnippets)
+	app.Get("/api/snippets/:id", middleware.OptionalAuth(cfg), controllers.GetSnippet)
+	app.Get("/api/snippets/:id/related", middleware.OptionalAuth(cfg), controllers.GetRelatedSnippets)
+
+	// Ranked feeds
+	app.Get("/api/feed/hot", middleware.OptionalAuth(cfg), controllers.GetHotFeed)
+	app.Get("/api/feed/trending", middleware.OptionalAuth(cfg), controllers.GetTrendingFeed)
+	app.Get("/api/leaderboards/authors", controllers.GetAuthorLeaderboard(cfg))
+	app.Get("/api/leaderboards/snippets", middleware.OptionalAuth(cfg), controllers.GetSnippetLeaderboard(cfg))
+
+	// Badge catalog
+	app.Get("/api/badges", controllers.GetBadgeCatalog)
+	app.Get("/api/reputation/privileges", controllers.GetReputationPrivileges)
 
-	// Public snippet route
-	app.Get("/api/snippets", controllers.GetSnippets)
+	// Public user profiles
+	app.Get("/api/users/:username", middleware.OptionalAuth(cfg), controllers.GetPublicProfile)
+	app.Get("/api/users/:username/followers", controllers.GetFollowers)
+	app.Get("/api/users/:username/following", controllers.GetFollowing)
+
+	// Secret share links resolve without logging in
+	app.Get("/s/:token", controllers.ResolveShareLink)
 
 	// Protected routes
-	api := app.Group("/api", middleware.AuthMiddleware())
+	api := app.Group("/api", middleware.AuthMiddleware(cfg))
 
 	// User routes
 	api.Get("/user/profile", controllers.GetUserProfile)
 	api.Put("/user/profile", controllers.UpdateUserProfile)
 
+	// Account security needs the admin scope when using an access token
+	admin := middleware.RequireScope(models.ScopeAdmin)
+
+	// Linked sign-in identities
+	api.Get("/user/identities", admin, controllers.GetUserIdentities)
+	api.Post("/user/identities/:provider/link", admin, controllers.LinkIdentity(cfg))
+	api.Delete("/user/identities/:id", admin, controllers.UnlinkIdentity)
+
+	// Sign-in sessions
+	api.Get("/user/sessions", admin, controllers.GetSessions)
+	api.Delete("/user/sessions", admin, controllers.RevokeAllSessions(cfg))
+	api.Delete("/user/sessions/:id", admin, controllers.RevokeSession)
+
+	// Personal access tokens
+	api.Post("/user/tokens", admin, controllers.CreateAccessToken)
+	api.Get("/user/tokens", admin, controllers.GetAccessTokens)
+	api.Delete("/user/tokens/:id", admin, controllers.RevokeAccessToken)
+
+	// Follows and the following feed
+	api.Post("/users/:username/follow", controllers.FollowUser)
+	api.Delete("/users/:username/follow", controllers.UnfollowUser)
+	api.Get("/feed/following", controllers.GetFollowingFeed)
+
+	// Followed tags and languages, their feed and digests
+	api.Get("/user/topics", controllers.GetFollowedTopics)
+	api.Put("/user/topics/digest", controllers.UpdateDigestFrequency)
+	api.Put("/user/topics/:kind/:name", controllers.FollowTopic)
+	api.Delete("/user/topics/:kind/:name", controllers.UnfollowTopic)
+	api.Get("/feed/topics", controllers.GetTopicFeed)
+	api.Get("/feed/for-you", controllers.GetForYouFeed)
+
+	// Notifications
+	api.Get("/user/notifications", controllers.GetNotifications)
+	api.Post("/user/notifications/:id/read", controllers.MarkNotificationRead)
+
 	// Snippet routes
-	api.Get("/snippets/:id", controllers.GetSnippet)
 	api.Put("/snippets/:id", controllers.UpdateSnippet)
+	api.Put("/snippets/:id/tags", controllers.UpdateSnippetTags)
 	api.Delete("/snippets/:id", controllers.DeleteSnippet)
 
 	// New: Reaction, bookmark, comment endpoints
@@ -47,4 +113,26 @@ func SetupRoutes(app *fiber.App) {
 
 	// Protected POST for creating snippets
 	api.Post("/snippets", controllers.CreateSnippet)
+
+	// Share link routes
+	api.Post("/snippets/:id/shares", controllers.CreateShareLink)
+	api.Get("/snippets/:id/shares", controllers.GetShareLinks)
+	api.Delete("/snippets/:id/shares/:linkId", controllers.RevokeShareLink)
+
+	// Organization routes
+	api.Post("/orgs", controllers.CreateOrg)
+	api.Get("/user/orgs", controllers.GetUserOrgs)
+	api.Get("/orgs/:slug", middleware.OrgAccess(policy.ReadOrg), controllers.GetOrg)
+	api.Put("/orgs/:slug", middleware.OrgAccess(policy.UpdateOrg), controllers.UpdateOrg)
+	api.Get("/orgs/:slug/snippets", middleware.OrgAccess(policy.ReadOrg), controllers.GetOrgSnippets)
+	api.Put("/orgs/:slug/members/:userId", middleware.OrgAccess(policy.ReadOrg), controllers.UpdateOrgMember)
+	api.Delete("/orgs/:slug/members/:userId", middleware.OrgAccess(policy.ReadOrg), controllers.RemoveOrgMember)
+
+	// Organization invitations
+	api.Post("/orgs/:slug/invitations", middleware.OrgAccess(policy.ManageInvitations), controllers.CreateOrgInvitation)
+	api.Get("/orgs/:slug/invitations", middleware.OrgAccess(policy.ManageInvitations), controllers.GetOrgInvitations)
+	api.Delete("/orgs/:slug/invitations/:invitationId", middleware.OrgAccess(policy.ManageInvitations), controllers.RevokeOrgInvitation)
+	api.Get("/user/invitations", controllers.GetUserInvitations)
+	api.Post("/invitations/:id/accept", controllers.AcceptInvitation)
+	api.Post("/invitations/:id/decline", controllers.DeclineInvitation)
 }
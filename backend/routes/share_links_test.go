@@ -0,0 +1,155 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"snippedia/models"
+	"snippedia/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func (f *privacyFixture) send(t *testing.T, viewer, method, path, body string) (int, []byte) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if token := f.tokens[viewer]; token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	resp, err := f.app.Test(req, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+type createdShareLink struct {
+	Link  models.ShareLink `json:"link"`
+	Token string           `json:"token"`
+}
+
+// share creates a share link for the author's private snippet
+func (f *privacyFixture) share(t *testing.T, body string) createdShareLink {
+	t.Helper()
+	path := "/api/snippets/" + f.secret[models.VisibilityPrivate].ID.Hex() + "/shares"
+	status, data := f.send(t, author, "POST", path, body)
+	if status != fiber.StatusCreated {
+		t.Fatalf("creating share link: status = %d: %s", status, data)
+	}
+	var created createdShareLink
+	if err := json.Unmarshal(data, &created); err != nil {
+		t.Fatal(err)
+	}
+	return created
+}
+
+// resolves reports whether the share link opens the private snippet
+func (f *privacyFixture) resolves(t *testing.T, token string) bool {
+	t.Helper()
+	status, body := f.get(t, anonymous, "/s/"+token)
+	if status == fiber.StatusOK {
+		return bytes.Contains(body, []byte(f.secret[models.VisibilityPrivate].Title))
+	}
+	if status != fiber.StatusNotFound {
+		t.Fatalf("resolving share link: status = %d: %s", status, body)
+	}
+	return false
+}
+
+func TestShareLinkStoresOnlyTheTokenHash(t *testing.T) {
+	f := newPrivacyFixture(t)
+	created := f.share(t, "")
+	if !f.resolves(t, created.Token) {
+		t.Fatal("share link does not open the snippet")
+	}
+
+	var stored bson.M
+	err := utils.GetCollection("share_links").FindOne(context.Background(), bson.M{"_id": created.Link.ID}).Decode(&stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored["token_hash"] != utils.HashToken(created.Token) {
+		t.Errorf("token_hash = %v, want the token's hash", stored["token_hash"])
+	}
+	for field, value := range stored {
+		if value == created.Token {
+			t.Errorf("token stored in plain text as %s", field)
+		}
+	}
+	// The hash is not a credential itself
+	if f.resolves(t, utils.HashToken(created.Token)) || f.resolves(t, created.Token+"x") {
+		t.Error("share link opened with the wrong token")
+	}
+}
+
+func TestShareLinkViewLimit(t *testing.T) {
+	f := newPrivacyFixture(t)
+	created := f.share(t, `{"max_views":2}`)
+	for i := 0; i < 2; i++ {
+		if !f.resolves(t, created.Token) {
+			t.Fatalf("view %d refused", i+1)
+		}
+	}
+	if f.resolves(t, created.Token) {
+		t.Error("share link opened after its views ran out")
+	}
+}
+
+func TestShareLinkExpiry(t *testing.T) {
+	f := newPrivacyFixture(t)
+	created := f.share(t, `{"expires_in_hours":1}`)
+	if created.Link.ExpiresAt == nil || time.Until(*created.Link.ExpiresAt) > time.Hour {
+		t.Fatalf("expires_at = %v, want within the hour", created.Link.ExpiresAt)
+	}
+	if !f.resolves(t, created.Token) {
+		t.Fatal("share link refused before it expired")
+	}
+	_, err := utils.GetCollection("share_links").UpdateByID(context.Background(), created.Link.ID,
+		bson.M{"$set": bson.M{"expires_at": time.Now().Add(-time.Minute)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.resolves(t, created.Token) {
+		t.Error("share link opened after it expired")
+	}
+
+	path := "/api/snippets/" + f.secret[models.VisibilityPrivate].ID.Hex() + "/shares"
+	for _, hours := range []int{-1, 24*365 + 1} {
+		body := `{"expires_in_hours":` + strconv.Itoa(hours) + `}`
+		if status, data := f.send(t, author, "POST", path, body); status != fiber.StatusBadRequest {
+			t.Errorf("expiry of %d hours: status = %d, want 400: %s", hours, status, data)
+		}
+	}
+}
+
+func TestShareLinkRevocation(t *testing.T) {
+	f := newPrivacyFixture(t)
+	created := f.share(t, "")
+	path := "/api/snippets/" + f.secret[models.VisibilityPrivate].ID.Hex() + "/shares/" + created.Link.ID.Hex()
+
+	// Only the author can revoke it
+	if status, data := f.send(t, stranger, "DELETE", path, ""); status != fiber.StatusNotFound {
+		t.Errorf("stranger revoking: status = %d, want 404: %s", status, data)
+	}
+	if !f.resolves(t, created.Token) {
+		t.Fatal("share link refused before it was revoked")
+	}
+	if status, data := f.send(t, author, "DELETE", path, ""); status != fiber.StatusOK {
+		t.Fatalf("revoking: status = %d: %s", status, data)
+	}
+	if f.resolves(t, created.Token) {
+		t.Error("share link opened after it was revoked")
+	}
+}
@@ -0,0 +1,232 @@
+// Package views counts how often snippets are viewed. Views are buffered in
+// memory and written in batches, so reading a snippet does not write to the
+// database, and each viewer counts once per snippet within a time window.
+package views
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"snippedia/models"
+	"snippedia/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// window is how long a viewer's repeated views of a snippet count once
+	window = 30 * time.Minute
+
+	// flushInterval is how often buffered views are written
+	flushInterval = 10 * time.Second
+
+	// maxSeen bounds how many recent viewers are remembered; beyond it the
+	// viewers remembered longest are forgotten first
+	maxSeen = 100000
+
+	// maxEvents bounds the view engagement waiting to be written; beyond it
+	// views are still counted but do not feed the rankings
+	maxEvents = 10000
+
+	// anonymousPrefix marks the viewers identified by address
+	anonymousPrefix = "anon:"
+
+	// flushAt flushes early when this many views are waiting
+	flushAt = 1000
+)
+
+type viewKey struct {
+	snippetID primitive.ObjectID
+	viewer    string
+}
+
+// seenEntry is a view in the order viewers counted. Entries of viewers that
+// counted again later are stale and skipped.
+type seenEntry struct {
+	key viewKey
+	at  time.Time
+}
+
+var buffer = struct {
+	sync.Mutex
+	seen    map[viewKey]time.Time        // when each viewer last counted
+	order   []seenEntry                  // seen, oldest first
+	pending map[primitive.ObjectID]int64 // views not yet written
+	events  []models.EngagementEvent     // view engagement not yet written
+}{
+	seen:    map[viewKey]time.Time{},
+	pending: map[primitive.ObjectID]int64{},
+}
+
+// UserViewer identifies a signed-in viewer
+func UserViewer(userID primitive.ObjectID) string {
+	return userID.Hex()
+}
+
+// AnonymousViewer identifies an anonymous viewer by their address. Headers
+// like the User-Agent are left out since clients can vary them at will.
+// Only a hash is kept.
+func AnonymousViewer(ip string) string {
+	return anonymousPrefix + utils.HashToken(ip)
+}
+
+// Record counts a view of the snippet unless the viewer already viewed it
+// within the window. Only views by signed-in viewers feed the rankings;
+// anyone can pose as many anonymous viewers.
+func Record(snippetID primitive.ObjectID, viewer string) {
+	if record(snippetID, viewer, time.Now()) {
+		go flushAndLog()
+	}
+}
+
+// record counts a view at now and reports whether enough views are waiting
+// to flush early
+func record(snippetID primitive.ObjectID, viewer string, now time.Time) bool {
+	key := viewKey{snippetID: snippetID, viewer: viewer}
+
+	buffer.Lock()
+	defer buffer.Unlock()
+	if last, ok := buffer.seen[key]; ok && now.Sub(last) < window {
+		return false
+	}
+	for len(buffer.seen) >= maxSeen {
+		if !forgetOldest() {
+			break
+		}
+	}
+	buffer.seen[key] = now
+	buffer.order = append(buffer.order, seenEntry{key: key, at: now})
+	buffer.pending[snippetID]++
+	if strings.HasPrefix(viewer, anonymousPrefix) || len(buffer.events) >= maxEvents {
+		return false
+	}
+	buffer.events = append(buffer.events, models.EngagementEvent{
+		ID:        primitive.NewObjectID(),
+		SnippetID: snippetID,
+		Kind:      models.EngagementView,
+		Actor:     viewer,
+		CreatedAt: now,
+	})
+	return len(buffer.events) == flushAt
+}
+
+// forgetOldest forgets the viewer remembered longest and reports whether
+// there was one. The caller holds the buffer lock.
+func forgetOldest() bool {
+	for len(buffer.order) > 0 {
+		oldest := buffer.order[0]
+		buffer.order = buffer.order[1:]
+		if last, ok := buffer.seen[oldest.key]; ok && last.Equal(oldest.at) {
+			delete(buffer.seen, oldest.key)
+			return true
+		}
+	}
+	return false
+}
+
+// forgetExpired forgets viewers whose window has passed. The caller holds
+// the buffer lock.
+func forgetExpired(now time.Time) {
+	for len(buffer.order) > 0 && now.Sub(buffer.order[0].at) >= window {
+		oldest := buffer.order[0]
+		buffer.order = buffer.order[1:]
+		if last, ok := buffer.seen[oldest.key]; ok && last.Equal(oldest.at) {
+			delete(buffer.seen, oldest.key)
+		}
+	}
+}
+
+// Start writes buffered views periodically in the background
+func Start() {
+	go func() {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			flushAndLog()
+		}
+	}()
+}
+
+func flushAndLog() {
+	if err := Flush(context.Background()); err != nil {
+		log.Println("Failed to write views:", err)
+	}
+}
+
+// Flush writes the buffered views: one increment per snippet and the view
+// engagement that feeds the rankings. Whatever fails to be written goes
+// back into the buffer for the next flush. It also forgets viewers whose
+// window has passed.
+func Flush(ctx context.Context) error {
+	buffer.Lock()
+	pending, events := buffer.pending, buffer.events
+	buffer.pending = map[primitive.ObjectID]int64{}
+	buffer.events = nil
+	forgetExpired(time.Now())
+	buffer.Unlock()
+
+	if len(pending) > 0 {
+		updates := make([]mongo.WriteModel, 0, len(pending))
+		for id, n := range pending {
+			updates = append(updates, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": id}).
+				SetUpdate(bson.M{"$inc": bson.M{"views": n}}))
+		}
+		_, err := utils.GetCollection("snippets").BulkWrite(ctx, updates, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			// An unordered write may have applied some increments; counting
+			// those twice beats losing every view in the batch
+			restore(pending, events)
+			return err
+		}
+	}
+
+	if len(events) > 0 {
+		// Each viewer counts once per snippet towards the rankings, so most
+		// of these are duplicates that the unique index turns away
+		docs := make([]interface{}, 0, len(events))
+		for _, e := range events {
+			docs = append(docs, e)
+		}
+		_, err := utils.GetCollection("engagement_events").InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		if err != nil && !isOnlyDuplicates(err) {
+			restore(nil, events)
+			return err
+		}
+	}
+	return nil
+}
+
+// restore puts views that could not be written back into the buffer
+func restore(pending map[primitive.ObjectID]int64, events []models.EngagementEvent) {
+	buffer.Lock()
+	defer buffer.Unlock()
+	for id, n := range pending {
+		buffer.pending[id] += n
+	}
+	room := maxEvents - len(buffer.events)
+	if room < len(events) {
+		events = events[:room]
+	}
+	buffer.events = append(buffer.events, events...)
+}
+
+// isOnlyDuplicates reports whether every failed write was a duplicate key
+func isOnlyDuplicates(err error) bool {
+	bulk, ok := err.(mongo.BulkWriteException)
+	if !ok || bulk.WriteConcernError != nil {
+		return false
+	}
+	for _, e := range bulk.WriteErrors {
+		if !mongo.IsDuplicateKeyError(e) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package views
+
+import (
+	"testing"
+	"time"
+
+	"snippedia/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// resetBuffer empties the buffer for a test and again once it is done
+func resetBuffer(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		buffer.Lock()
+		buffer.seen = map[viewKey]time.Time{}
+		buffer.order = nil
+		buffer.pending = map[primitive.ObjectID]int64{}
+		buffer.events = nil
+		buffer.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestRecordCountsOncePerWindow(t *testing.T) {
+	resetBuffer(t)
+	snippetID := primitive.NewObjectID()
+	viewer := UserViewer(primitive.NewObjectID())
+	start := time.Now()
+
+	record(snippetID, viewer, start)
+	record(snippetID, viewer, start.Add(time.Minute))
+	record(snippetID, viewer, start.Add(window-time.Second))
+	if got := buffer.pending[snippetID]; got != 1 {
+		t.Fatalf("views within the window = %d, want 1", got)
+	}
+	record(snippetID, viewer, start.Add(window))
+	if got := buffer.pending[snippetID]; got != 2 {
+		t.Errorf("views after the window = %d, want 2", got)
+	}
+	record(primitive.NewObjectID(), viewer, start.Add(window))
+	record(snippetID, UserViewer(primitive.NewObjectID()), start.Add(window))
+	if got := buffer.pending[snippetID]; got != 3 {
+		t.Errorf("views by another viewer = %d, want 3", got)
+	}
+	if got := len(buffer.events); got != 4 {
+		t.Errorf("%d view events, want 4", got)
+	}
+}
+
+func TestAnonymousViewsDoNotFeedRankings(t *testing.T) {
+	resetBuffer(t)
+	snippetID := primitive.NewObjectID()
+	now := time.Now()
+
+	record(snippetID, AnonymousViewer("192.0.2.1"), now)
+	record(snippetID, AnonymousViewer("192.0.2.1"), now.Add(time.Minute))
+	record(snippetID, AnonymousViewer("192.0.2.2"), now)
+	if got := buffer.pending[snippetID]; got != 2 {
+		t.Errorf("anonymous views = %d, want 2", got)
+	}
+	if len(buffer.events) != 0 {
+		t.Errorf("anonymous views wrote %d ranking events", len(buffer.events))
+	}
+}
+
+func TestRecordForgetsOldestViewersWhenFull(t *testing.T) {
+	resetBuffer(t)
+	snippetID := primitive.NewObjectID()
+	start := time.Now()
+	first := UserViewer(primitive.NewObjectID())
+	record(snippetID, first, start)
+	for i := 1; i < maxSeen; i++ {
+		record(snippetID, AnonymousViewer(primitive.NewObjectID().Hex()), start.Add(time.Millisecond))
+	}
+	if len(buffer.seen) != maxSeen {
+		t.Fatalf("%d viewers remembered, want %d", len(buffer.seen), maxSeen)
+	}
+
+	// A new viewer still counts and pushes out the oldest
+	latest := UserViewer(primitive.NewObjectID())
+	record(snippetID, latest, start.Add(time.Second))
+	if len(buffer.seen) != maxSeen {
+		t.Errorf("%d viewers remembered, want %d", len(buffer.seen), maxSeen)
+	}
+	if _, ok := buffer.seen[viewKey{snippetID, latest}]; !ok {
+		t.Error("new viewer not counted once the viewers were full")
+	}
+	if _, ok := buffer.seen[viewKey{snippetID, first}]; ok {
+		t.Error("oldest viewer still remembered")
+	}
+	if got := buffer.pending[snippetID]; got != maxSeen+1 {
+		t.Errorf("views = %d, want %d", got, maxSeen+1)
+	}
+}
+
+func TestRecordCapsEvents(t *testing.T) {
+	resetBuffer(t)
+	snippetID := primitive.NewObjectID()
+	now := time.Now()
+	flushes := 0
+	for i := 0; i < maxEvents+10; i++ {
+		if record(snippetID, UserViewer(primitive.NewObjectID()), now) {
+			flushes++
+		}
+	}
+	if len(buffer.events) != maxEvents {
+		t.Errorf("%d events waiting, want %d", len(buffer.events), maxEvents)
+	}
+	if flushes != 1 {
+		t.Errorf("asked to flush %d times, want once at %d events", flushes, flushAt)
+	}
+	if got := buffer.pending[snippetID]; got != maxEvents+10 {
+		t.Errorf("views = %d, want every view counted", got)
+	}
+}
+
+func TestForgetExpired(t *testing.T) {
+	resetBuffer(t)
+	snippetID := primitive.NewObjectID()
+	start := time.Now()
+	old, recent := UserViewer(primitive.NewObjectID()), UserViewer(primitive.NewObjectID())
+	record(snippetID, old, start)
+	record(snippetID, recent, start.Add(window/2))
+	// Counting again leaves a stale entry behind
+	record(snippetID, old, start.Add(window))
+
+	buffer.Lock()
+	forgetExpired(start.Add(window + time.Second))
+	buffer.Unlock()
+	if _, ok := buffer.seen[viewKey{snippetID, old}]; !ok {
+		t.Error("viewer that counted again was forgotten")
+	}
+	if _, ok := buffer.seen[viewKey{snippetID, recent}]; !ok {
+		t.Error("viewer within the window was forgotten")
+	}
+
+	buffer.Lock()
+	forgetExpired(start.Add(2 * window))
+	buffer.Unlock()
+	if len(buffer.seen) != 0 || len(buffer.order) != 0 {
+		t.Errorf("expired viewers remembered: %d seen, %d ordered", len(buffer.seen), len(buffer.order))
+	}
+}
+
+func TestRestore(t *testing.T) {
+	resetBuffer(t)
+	snippetID := primitive.NewObjectID()
+	now := time.Now()
+	record(snippetID, UserViewer(primitive.NewObjectID()), now)
+
+	event := func() models.EngagementEvent {
+		return models.EngagementEvent{ID: primitive.NewObjectID(), SnippetID: snippetID, Kind: models.EngagementView}
+	}
+	restore(map[primitive.ObjectID]int64{snippetID: 5}, []models.EngagementEvent{event(), event()})
+	if got := buffer.pending[snippetID]; got != 6 {
+		t.Errorf("views = %d, want the restored ones added", got)
+	}
+	if len(buffer.events) != 3 {
+		t.Errorf("%d events, want 3", len(buffer.events))
+	}
+
+	// Restoring never grows the events past the cap
+	many := make([]models.EngagementEvent, maxEvents)
+	for i := range many {
+		many[i] = event()
+	}
+	restore(nil, many)
+	if len(buffer.events) != maxEvents {
+		t.Errorf("%d events after restoring, want %d", len(buffer.events), maxEvents)
+	}
+}
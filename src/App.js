@@ -14,10 +14,21 @@ export const FRONTEND_URL = process.env.REACT_APP_FRONTEND_URL || 'http://localh
 function App() {
   React.useEffect(() => {
     const params = new URLSearchParams(window.location.search);
-    const token = params.get('token');
-    if (token) {
-      localStorage.setItem('jwt', token);
-      window.location.replace('/feed');
+    const code = params.get('auth_code');
+    if (code) {
+      // Trade the one-time login code for an access and refresh token
+      fetch(`${API_URL}/auth/token`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ code })
+      })
+        .then(res => (res.ok ? res.json() : Promise.reject(res)))
+        .then(data => {
+          localStorage.setItem('jwt', data.token);
+          localStorage.setItem('refresh_token', data.refresh_token);
+          window.location.replace('/feed');
+        })
+        .catch(() => window.location.replace('/login'));
     }
   }, []);
 
@@ -0,0 +1,68 @@
+import { API_URL } from './App';
+
+// Access tokens are short-lived. When the API answers 401, trade the refresh
+// token for a new pair once and retry the request with the new access token.
+let refreshing = null;
+
+function refreshTokens() {
+  if (!refreshing) {
+    const refreshToken = localStorage.getItem('refresh_token');
+    refreshing = (refreshToken
+      ? window.nativeFetch(`${API_URL}/auth/refresh`, {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json', 'X-Requested-With': 'XMLHttpRequest' },
+          body: JSON.stringify({ refresh_token: refreshToken })
+        })
+          .then(res => (res.ok ? res.json() : Promise.reject(res)))
+          .then(data => {
+            localStorage.setItem('jwt', data.token);
+            localStorage.setItem('refresh_token', data.refresh_token);
+            return data.token;
+          })
+      : Promise.reject(new Error('No refresh token'))
+    )
+      .catch(err => {
+        clearTokens();
+        throw err;
+      })
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+}
+
+export function clearTokens() {
+  localStorage.removeItem('jwt');
+  localStorage.removeItem('refresh_token');
+}
+
+export function logout() {
+  const refreshToken = localStorage.getItem('refresh_token');
+  clearTokens();
+  return window.nativeFetch(`${API_URL}/auth/logout`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', 'X-Requested-With': 'XMLHttpRequest' },
+    body: JSON.stringify({ refresh_token: refreshToken || '' })
+  }).catch(() => {});
+}
+
+export function installFetchRefresh() {
+  window.nativeFetch = window.fetch.bind(window);
+  window.fetch = async (input, init = {}) => {
+    const res = await window.nativeFetch(input, init);
+    const url = typeof input === 'string' ? input : input.url;
+    if (res.status !== 401 || !url.includes('/api/') || !localStorage.getItem('refresh_token')) {
+      return res;
+    }
+    let token;
+    try {
+      token = await refreshTokens();
+    } catch (err) {
+      return res;
+    }
+    const headers = new Headers(init.headers || {});
+    headers.set('Authorization', `Bearer ${token}`);
+    return window.nativeFetch(input, { ...init, headers });
+  };
+}
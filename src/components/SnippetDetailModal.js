@@ -202,7 +202,7 @@ const SnippetDetailModal = ({ snippet, onClose }) => {
               width="100%"
               language={snippet.language === 'cpp' ? 'cpp' : snippet.language}
               theme="vs-dark"
-              value={snippet.code}
+              value={snippet.code || (snippet.files && snippet.files.length ? snippet.files[0].content : '')}
               options={{
                 readOnly: true,
                 minimap: { enabled: false },
@@ -2,6 +2,9 @@ import React from 'react';
 import ReactDOM from 'react-dom/client';
 import './styles/index.css';
 import App from './App';
+import { installFetchRefresh } from './auth';
+
+installFetchRefresh();
 
 const root = ReactDOM.createRoot(document.getElementById('root'));
 root.render(
@@ -4,6 +4,7 @@ import SnippetCard from '../components/SnippetCard';
 import SnippetDetailModal from '../components/SnippetDetailModal';
 import Navbar from '../components/Navbar';
 import { API_URL } from '../App';
+import { logout } from '../auth';
 // import SubmitPage from './SubmitPage'; // We'll use a modal instead
 
 const MainFeed = () => {
@@ -141,7 +142,7 @@ const MainFeed = () => {
 
   // Logout functionality
   const handleLogout = () => {
-    localStorage.removeItem('jwt');
+    logout();
     navigate('/login');
   };
 
@@ -177,7 +178,7 @@ const MainFeed = () => {
     author_avatar: snippet.author_avatar,
     author_github: snippet.author_github || '',
     author_bio: snippet.author_bio || '',
-    code: snippet.code || '',
+    code: snippet.code || (snippet.files && snippet.files.length ? snippet.files[0].content : ''),
     description: snippet.description || '',
     language: snippet.language || '',
     id: snippet.id || snippet._id,
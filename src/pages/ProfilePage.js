@@ -3,6 +3,7 @@ import SnippetCard from '../components/SnippetCard';
 import Navbar from '../components/Navbar';
 import SnippetDetailModal from '../components/SnippetDetailModal';
 import { API_URL } from '../App';
+import { logout } from '../auth';
 
 const ProfilePage = () => {
   const [activeTab, setActiveTab] = useState('snippets');
@@ -94,7 +95,8 @@ const ProfilePage = () => {
         ) : (
           badges.map((badge, index) => (
             <div key={index} className="bg-gray-700 rounded-lg p-4 hover:shadow-lg transition-shadow">
-              <h3 className="font-bold">{badge}</h3>
+              <h3 className="font-bold">{badge.badge}</h3>
+              <p className="text-sm text-gray-400">Awarded {new Date(badge.awarded_at).toLocaleDateString()}</p>
             </div>
           ))
         );
@@ -108,7 +110,7 @@ const ProfilePage = () => {
 
   return (
     <div className="bg-gray-900 text-white min-h-screen flex flex-col">
-      <Navbar search={''} setSearch={() => {}} showSearch={false} showCreate={false} onLogout={() => { localStorage.removeItem('jwt'); window.location.href = '/login'; }} />
+      <Navbar search={''} setSearch={() => {}} showSearch={false} showCreate={false} onLogout={() => { logout(); window.location.href = '/login'; }} />
       <div className="p-4 sm:p-10 flex flex-col items-center md:items-start md:flex-row justify-center flex-1">
         <div className="bg-gray-800 rounded-lg p-4 sm:p-10 shadow-lg w-full max-w-6xl">
           <div className="flex flex-col md:flex-row items-center mb-8 md:mb-10">